@@ -6,6 +6,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/leeola/fixity/config"
 )
@@ -38,10 +40,69 @@ type BlobWriter interface {
 	Write(context.Context, []byte) (Ref, error)
 }
 
+// BlobWriterFrom is an optional BlobWriter interface to write a blob
+// from a reader, without holding the entire blob in memory.
+type BlobWriterFrom interface {
+	WriteFrom(context.Context, io.Reader) (Ref, error)
+}
+
 type BlobReader interface {
 	Read(context.Context, Ref) (io.ReadCloser, error)
 }
 
+// BlobLister is an optional Blobstore interface to enumerate stored blobs.
+type BlobLister interface {
+	// List calls fn with the ref of each stored blob, in ascending order
+	// of the decoded ref bytes, starting after the given cursor ref. An
+	// empty cursor lists from the first blob.
+	//
+	// Listing stops if fn returns an error or the context is done,
+	// returning that error. Listing can then be resumed by using the last
+	// ref given to fn as the cursor.
+	List(ctx context.Context, after Ref, fn func(Ref) error) error
+}
+
+// BlobDeleter is an optional Blobstore interface to remove stored blobs.
+type BlobDeleter interface {
+	// Delete removes the blob of the given ref. Deleting a blob which
+	// does not exist is not an error.
+	Delete(context.Context, Ref) error
+}
+
+// BlobStater is an optional Blobstore interface to describe stored blobs
+// without reading them.
+type BlobStater interface {
+	Stat(context.Context, Ref) (BlobInfo, error)
+}
+
+// BlobWriteLocker is an optional Blobstore interface to block writes,
+// including writes from other processes, while deleting blobs.
+type BlobWriteLocker interface {
+	LockWrites() (unlock func() error, err error)
+}
+
+type BlobInfo struct {
+	Size int64
+
+	// ModTime is the time the blob was last written.
+	ModTime time.Time
+}
+
+// WriteFrom writes the blob from the reader, streaming it if the writer
+// implements BlobWriterFrom and buffering it otherwise.
+func WriteFrom(ctx context.Context, w BlobWriter, r io.Reader) (Ref, error) {
+	if wf, ok := w.(BlobWriterFrom); ok {
+		return wf.WriteFrom(ctx, r)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("readall: %v", err)
+	}
+
+	return w.Write(ctx, b)
+}
+
 func NewBlobstoreFromConfig(name string, c config.Config) (Blobstore, error) {
 	if name == "" {
 		return nil, fmt.Errorf("empty blobstore name")
@@ -62,5 +123,9 @@ func NewBlobstoreFromConfig(name string, c config.Config) (Blobstore, error) {
 		return nil, fmt.Errorf("blobstore constructor %s: %v", name, err)
 	}
 
+	if tc.VerifyReads {
+		bs = NewVerifyBlobstore(bs)
+	}
+
 	return bs, nil
 }
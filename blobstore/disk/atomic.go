@@ -0,0 +1,108 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempMaxAge is the age after which a temp file is assumed to be left
+// behind by a crashed write. Temp files are written to continuously, so
+// the modtime of a temp file still being written stays recent.
+const tempMaxAge = 24 * time.Hour
+
+// isTemp returns true if the file name is a temp file of writeTemp.
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp")
+}
+
+// writeFileAtomic writes the bytes to a temp file in the same directory as
+// the path, syncs it and renames it to the path, so that the path never
+// contains partially written bytes, even after a crash.
+//
+// The temp file name is not valid hex, so it is ignored by List if left
+// behind by a crash.
+func writeFileAtomic(p string, b []byte, perm os.FileMode) error {
+	tmpPath, err := writeTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp", bytes.NewReader(b), perm)
+	if err != nil {
+		return err // no wrap helper err
+	}
+
+	if err := renameSync(tmpPath, p); err != nil {
+		os.Remove(tmpPath)
+		return err // no wrap helper err
+	}
+
+	return nil
+}
+
+// writeTemp copies the reader into a synced temp file in dir, returning
+// the path of the temp file.
+func writeTemp(dir, prefix string, r io.Reader, perm os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(dir, prefix)
+	if err != nil {
+		return "", fmt.Errorf("tempfile: %v", err)
+	}
+	tmpPath := f.Name()
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("chmod: %v", err)
+	}
+
+	if err := copySyncClose(f, r); err != nil {
+		os.Remove(tmpPath)
+		return "", err // no wrap helper err
+	}
+
+	return tmpPath, nil
+}
+
+func copySyncClose(f *os.File, r io.Reader) error {
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("copy: %v", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %v", err)
+	}
+
+	return nil
+}
+
+// renameSync renames the temp path to the path and syncs the directory of
+// the path, persisting the rename.
+func renameSync(tmpPath, p string) error {
+	if err := os.Rename(tmpPath, p); err != nil {
+		return fmt.Errorf("rename: %v", err)
+	}
+
+	if err := syncDir(filepath.Dir(p)); err != nil {
+		return fmt.Errorf("syncdir: %v", err)
+	}
+
+	return nil
+}
+
+// syncDir syncs the directory, persisting renames within it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open: %v", err)
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
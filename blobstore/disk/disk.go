@@ -2,20 +2,27 @@ package disk
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sync"
+	"time"
 
+	base58 "github.com/jbenet/go-base58"
 	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/config"
 	"github.com/leeola/fixity/util/pathutil"
 )
 
-const bsDir = "blobs"
+const (
+	bsDir = "blobs"
+
+	// lockFile is the advisory lock file within the blobstore path, used by
+	// LockWrites. The name is not valid hex, so it is ignored by List.
+	lockFile = ".lock"
+)
 
 type Config struct {
 	Path string `json:"path"`
@@ -24,11 +31,11 @@ type Config struct {
 
 // Blobstore implements a Fixity Blobstore for an simple Filesystem.
 //
-// NOTE: Blobstore is not safe for concurrent use out of process, but
-// side effects are mostly harmless. Safe readers of partial writes
-// should verify data regardless.
+// Blobstore is safe for concurrent use in and out of process. Blobs are
+// written to a temp file and renamed into place, so readers never see
+// partial writes and need no locking. Writes only take a shared advisory
+// lock, to be blocked while another process holds LockWrites.
 type Blobstore struct {
-	mu   sync.Mutex
 	path string
 	flat bool
 }
@@ -59,9 +66,6 @@ func New(name string, cfg config.Config) (*Blobstore, error) {
 }
 
 func (s *Blobstore) Read(_ context.Context, h fixity.Ref) (io.ReadCloser, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if h == "" {
 		return nil, errors.New("hash cannot be empty")
 	}
@@ -80,23 +84,221 @@ func (s *Blobstore) Read(_ context.Context, h fixity.Ref) (io.ReadCloser, error)
 }
 
 func (s *Blobstore) Write(_ context.Context, b []byte) (fixity.Ref, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	h, err := fixity.Hash(b)
 	if err != nil {
 		return "", fmt.Errorf("hash: %v", err)
 	}
 
+	unlock, err := flock(s.lockPath(), false)
+	if err != nil {
+		return "", fmt.Errorf("lock: %v", err)
+	}
+	defer unlock()
+
 	p := s.pathHash(string(h))
 
+	if reuse(p, int64(len(b))) {
+		return h, nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
 		return "", fmt.Errorf("mkdirall: %v", err)
 	}
 
-	if err := ioutil.WriteFile(p, b, 0644); err != nil {
-		return "", fmt.Errorf("writefile: %v", err)
+	if err := writeFileAtomic(p, b, 0644); err != nil {
+		return "", fmt.Errorf("writefileatomic: %v", err)
 	}
 
 	return h, nil
 }
+
+// WriteFrom implements fixity.BlobWriterFrom, hashing the blob while it
+// is streamed to a temp file within the blobstore path. The temp file is
+// renamed into place once the ref is known.
+func (s *Blobstore) WriteFrom(ctx context.Context, r io.Reader) (fixity.Ref, error) {
+	hasher, err := fixity.Hasher(fixity.DefaultMultihashName)
+	if err != nil {
+		return "", fmt.Errorf("hasher: %v", err)
+	}
+
+	unlock, err := flock(s.lockPath(), false)
+	if err != nil {
+		return "", fmt.Errorf("lock: %v", err)
+	}
+	defer unlock()
+
+	tmpPath, err := writeTemp(s.path, ".write.tmp", io.TeeReader(&ctxReader{ctx: ctx, r: r}, hasher), 0644)
+	if err != nil {
+		return "", fmt.Errorf("writetemp: %v", err)
+	}
+
+	h, err := fixity.HashRef(hasher.Sum(nil))
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("hashref: %v", err)
+	}
+
+	p := s.pathHash(string(h))
+
+	tmpInfo, err := os.Stat(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("stat: %v", err)
+	}
+
+	if reuse(p, tmpInfo.Size()) {
+		os.Remove(tmpPath)
+		return h, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("mkdirall: %v", err)
+	}
+
+	if err := renameSync(tmpPath, p); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("renamesync: %v", err)
+	}
+
+	return h, nil
+}
+
+// reuse returns true if the blob path exists with the given size, updating
+// its modtime.
+//
+// Blobs are content addressed, so an existing blob already contains the
+// written bytes, unless it was truncated by a crash before blobs were
+// written atomically. Such a blob differs in size and is rewritten. The
+// modtime is updated so that the reused blob is protected by the grace
+// period of a concurrent garbage collection.
+func reuse(p string, size int64) bool {
+	fi, err := os.Stat(p)
+	if err != nil || fi.Size() != size {
+		return false
+	}
+
+	now := time.Now()
+	return os.Chtimes(p, now, now) == nil
+}
+
+// ctxReader stops reading once the context is done, aborting streaming
+// writes of long or never ending readers.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Delete removes the blob of the given ref.
+//
+// Delete does not lock, callers should hold LockWrites to avoid deleting
+// blobs being reused by concurrent writes.
+func (s *Blobstore) Delete(_ context.Context, h fixity.Ref) error {
+	if h == "" {
+		return errors.New("hash cannot be empty")
+	}
+
+	err := os.Remove(s.pathHash(string(h)))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Blobstore) Stat(_ context.Context, h fixity.Ref) (fixity.BlobInfo, error) {
+	if h == "" {
+		return fixity.BlobInfo{}, errors.New("hash cannot be empty")
+	}
+
+	fi, err := os.Stat(s.pathHash(string(h)))
+	if os.IsNotExist(err) {
+		return fixity.BlobInfo{}, err
+	}
+	if err != nil {
+		return fixity.BlobInfo{}, fmt.Errorf("stat: %v", err)
+	}
+
+	return fixity.BlobInfo{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}, nil
+}
+
+// LockWrites blocks all writes to the blobstore, including writes from
+// other processes, until unlock is called.
+func (s *Blobstore) LockWrites() (func() error, error) {
+	return flock(s.lockPath(), true)
+}
+
+func (s *Blobstore) lockPath() string {
+	return filepath.Join(s.path, lockFile)
+}
+
+// List implements fixity.BlobLister for both flat and nested layouts.
+//
+// Directories which only contain blobs before the cursor are skipped
+// without being read. Temp files left behind by crashed writes are
+// removed once they are older than tempMaxAge.
+func (s *Blobstore) List(ctx context.Context, after fixity.Ref, fn func(fixity.Ref) error) error {
+	cursor := hex.EncodeToString(base58.Decode(string(after)))
+
+	return filepath.Walk(s.path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !info.IsDir() && isTemp(info.Name()) {
+			if time.Since(info.ModTime()) > tempMaxAge {
+				if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("remove temp: %v", err)
+				}
+			}
+			return nil
+		}
+
+		h, ok := s.pathHex(p)
+		if !ok {
+			// not a blob or blob directory, ignore it.
+			return nil
+		}
+
+		if info.IsDir() {
+			if h == "" {
+				return nil
+			}
+			// a directory before the cursor prefix only contains blobs
+			// before the cursor.
+			prefix := cursor
+			if len(prefix) > len(h) {
+				prefix = prefix[:len(h)]
+			}
+			if h < prefix {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if h <= cursor {
+			return nil
+		}
+
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil
+		}
+
+		return fn(fixity.Ref(base58.Encode(b)))
+	})
+}
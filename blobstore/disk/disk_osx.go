@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"path/filepath"
+	"strings"
 
 	base58 "github.com/jbenet/go-base58"
 )
@@ -32,3 +33,25 @@ func (s *Blobstore) pathHash(h string) string {
 
 	return filepath.Join(s.path, p)
 }
+
+// pathHex returns the hex encoded ref, or ref prefix for a directory, of
+// the given path produced by pathHash.
+func (s *Blobstore) pathHex(p string) (string, bool) {
+	rel, err := filepath.Rel(s.path, p)
+	if err != nil {
+		return "", false
+	}
+
+	if rel == "." {
+		return "", true
+	}
+
+	h := strings.Replace(rel, string(filepath.Separator), "", -1)
+	for _, c := range h {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return "", false
+		}
+	}
+
+	return h, true
+}
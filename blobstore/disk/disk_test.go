@@ -0,0 +1,303 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+)
+
+var errStop = errors.New("stop")
+
+func TestList(t *testing.T) {
+	for _, flat := range []bool{true, false} {
+		t.Run(fmt.Sprintf("flat=%t", flat), func(t *testing.T) {
+			testList(t, flat)
+		})
+	}
+}
+
+func testList(t *testing.T, flat bool) {
+	dir, err := ioutil.TempDir("", "fixity-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bs := &Blobstore{path: dir, flat: flat}
+
+	written := map[fixity.Ref]bool{}
+	for i := 0; i < 20; i++ {
+		ref, err := bs.Write(ctx, []byte(fmt.Sprintf("blob %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written[ref] = true
+	}
+
+	var all []fixity.Ref
+	if err := bs.List(ctx, "", func(ref fixity.Ref) error {
+		all = append(all, ref)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != len(written) {
+		t.Fatalf("want:%d refs, got:%d", len(written), len(all))
+	}
+	for _, ref := range all {
+		if !written[ref] {
+			t.Errorf("listed unwritten ref: %q", ref)
+		}
+	}
+
+	// resume from a cursor in pages of 3.
+	var (
+		paged  []fixity.Ref
+		cursor fixity.Ref
+	)
+	for {
+		var page []fixity.Ref
+		err := bs.List(ctx, cursor, func(ref fixity.Ref) error {
+			page = append(page, ref)
+			if len(page) == 3 {
+				return errStop
+			}
+			return nil
+		})
+		if err != nil && err != errStop {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if err == nil {
+			break
+		}
+		cursor = page[len(page)-1]
+	}
+
+	if len(paged) != len(all) {
+		t.Fatalf("want:%d paged refs, got:%d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i] != all[i] {
+			t.Errorf("index %d want:%q, got:%q", i, all[i], paged[i])
+		}
+	}
+}
+
+func TestWriteAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bs := &Blobstore{path: dir, flat: true}
+
+	ref, err := bs.Write(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// temp files left behind by crashed writes, one old enough to be
+	// removed by List.
+	p := bs.pathHash(string(ref))
+	oldTemp := filepath.Join(dir, "."+filepath.Base(p)+".tmp123")
+	newTemp := filepath.Join(dir, ".write.tmp456")
+	for _, tp := range []string{oldTemp, newTemp} {
+		if err := ioutil.WriteFile(tp, []byte("fo"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * tempMaxAge)
+	if err := os.Chtimes(oldTemp, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewriting an existing blob must not fail or alter it.
+	if _, err := bs.Write(ctx, []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []fixity.Ref
+	if err := bs.List(ctx, "", func(ref fixity.Ref) error {
+		refs = append(refs, ref)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(refs) != 1 || refs[0] != ref {
+		t.Errorf("want:[%s], got:%v", ref, refs)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo" {
+		t.Errorf("want:foo, got:%q", b)
+	}
+
+	if _, err := os.Stat(oldTemp); !os.IsNotExist(err) {
+		t.Errorf("want old temp file removed, got:%v", err)
+	}
+	if _, err := os.Stat(newTemp); err != nil {
+		t.Errorf("want new temp file kept, got:%v", err)
+	}
+
+	// a blob truncated by a crash before writes were atomic is repaired.
+	if err := ioutil.WriteFile(p, []byte("fo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Write(ctx, []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(p); err != nil || string(b) != "foo" {
+		t.Errorf("want:foo, got:%q, %v", b, err)
+	}
+}
+
+func TestWriteFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bs := &Blobstore{path: dir}
+
+	content := strings.Repeat("foo", 10000)
+
+	want, err := fixity.Hash([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// once to write, and again to reuse the existing blob.
+	for i := 0; i < 2; i++ {
+		ref, err := bs.WriteFrom(ctx, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref != want {
+			t.Fatalf("want:%q, got:%q", want, ref)
+		}
+	}
+
+	b, err := ioutil.ReadFile(bs.pathHash(string(want)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Error("unexpected blob content")
+	}
+
+	// no temp files are left behind.
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range infos {
+		if strings.HasPrefix(fi.Name(), ".write") {
+			t.Errorf("temp file left behind: %s", fi.Name())
+		}
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := bs.WriteFrom(cctx, strings.NewReader("bar")); err == nil {
+		t.Error("want error from cancelled context")
+	}
+}
+
+func TestConcurrentWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	// separate instances share no memory, as separate processes would.
+	stores := []*Blobstore{{path: dir}, {path: dir}, {path: dir}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(bs *Blobstore, i int) {
+			defer wg.Done()
+
+			b := []byte(fmt.Sprintf("blob %d", i%5))
+			ref, err := bs.Write(ctx, b)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			rc, err := bs.Read(ctx, ref)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(got) != string(b) {
+				t.Errorf("want:%q, got:%q", b, got)
+			}
+		}(stores[i%len(stores)], i)
+	}
+	wg.Wait()
+}
+
+func TestLockWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs := &Blobstore{path: dir}
+
+	unlock, err := bs.LockWrites()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := bs.Write(context.Background(), []byte("foo"))
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("write completed while writes were locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
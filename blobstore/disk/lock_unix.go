@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// flock opens and locks the lock file, returning a func to unlock it.
+//
+// Each call opens the file separately, so that locks from goroutines of
+// the same process conflict the same as locks from other processes.
+func flock(p string, exclusive bool) (func() error, error) {
+	f, err := os.OpenFile(p, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open: %v", err)
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("flock: %v", err)
+	}
+
+	// closing the file releases the lock.
+	return f.Close, nil
+}
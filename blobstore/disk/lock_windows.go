@@ -0,0 +1,13 @@
+package disk
+
+import "github.com/leeola/fixity"
+
+// flock is not implemented on windows. Shared locks of writes are a noop,
+// and exclusive locks return fixity.ErrNotSupported, so that LockWrites
+// does not claim to block writes.
+func flock(p string, exclusive bool) (func() error, error) {
+	if exclusive {
+		return nil, fixity.ErrNotSupported
+	}
+	return func() error { return nil }, nil
+}
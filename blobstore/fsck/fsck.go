@@ -0,0 +1,398 @@
+// Package fsck verifies the integrity of every blob, data stream and index
+// entry of a store.
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/reader/blobreader"
+)
+
+// Blobstore is the set of Blobstore interfaces required to check.
+type Blobstore interface {
+	fixity.BlobReader
+	fixity.BlobLister
+}
+
+type Kind string
+
+const (
+	// KindCorrupt is a blob whose bytes do not hash to its ref.
+	KindCorrupt Kind = "corrupt"
+
+	// KindDangling is a ref to a blob which does not exist.
+	KindDangling Kind = "dangling"
+
+	// KindData is a data stream whose size or checksum does not match
+	// its DataSchema.
+	KindData Kind = "data"
+
+	// KindIndex is an index entry which does not point to a mutation.
+	KindIndex Kind = "index"
+)
+
+type Problem struct {
+	Kind Kind
+
+	// Ref is the damaged blob, or the blob referencing a missing blob.
+	Ref fixity.Ref
+
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Ref, p.Message)
+}
+
+type Report struct {
+	// Blobs is the number of blobs checked.
+	Blobs int
+
+	// Data is the number of data streams checked.
+	Data int
+
+	// Index is the number of index entries checked.
+	Index int
+
+	Problems []Problem
+}
+
+// Damaged returns true if any problems were found.
+func (r Report) Damaged() bool {
+	return len(r.Problems) != 0
+}
+
+// checker holds the state of a single Check.
+type checker struct {
+	ctx    context.Context
+	bs     Blobstore
+	report Report
+
+	// exists are all listed blobs.
+	exists map[fixity.Ref]bool
+
+	// corrupt are the blobs reported as corrupt.
+	corrupt map[fixity.Ref]bool
+
+	// mutations and data are the valid blobs of each schema, with the
+	// refs kept in list order for a stable report.
+	mutations    map[fixity.Ref]fixity.Mutation
+	mutationRefs []fixity.Ref
+	data         map[fixity.Ref]fixity.DataSchema
+	dataRefs     []fixity.Ref
+}
+
+// Check verifies every blob in the blobstore and, if ix is not nil, every
+// entry of the index.
+//
+// Each blob is hashed against its ref, each data stream is reassembled to
+// verify its size and checksum, and refs to missing blobs are reported as
+// dangling.
+func Check(ctx context.Context, bs Blobstore, ix index.Lister) (Report, error) {
+	c := &checker{
+		ctx:       ctx,
+		bs:        bs,
+		exists:    map[fixity.Ref]bool{},
+		corrupt:   map[fixity.Ref]bool{},
+		mutations: map[fixity.Ref]fixity.Mutation{},
+		data:      map[fixity.Ref]fixity.DataSchema{},
+	}
+
+	if err := bs.List(ctx, "", c.checkBlob); err != nil {
+		return Report{}, fmt.Errorf("list: %v", err)
+	}
+
+	for _, ref := range c.mutationRefs {
+		c.checkMutation(ref, c.mutations[ref])
+	}
+
+	for _, ref := range c.dataRefs {
+		if err := ctx.Err(); err != nil {
+			return Report{}, err
+		}
+		if err := c.checkData(ref, c.data[ref]); err != nil {
+			return Report{}, fmt.Errorf("data %q: %v", ref, err)
+		}
+	}
+
+	if ix != nil {
+		if err := ix.List(c.checkIndexEntry); err != nil {
+			return Report{}, fmt.Errorf("index list: %v", err)
+		}
+	}
+
+	return c.report, nil
+}
+
+func (c *checker) problem(kind Kind, ref fixity.Ref, format string, v ...interface{}) {
+	if kind == KindCorrupt {
+		c.corrupt[ref] = true
+	}
+	c.report.Problems = append(c.report.Problems, Problem{
+		Kind:    kind,
+		Ref:     ref,
+		Message: fmt.Sprintf(format, v...),
+	})
+}
+
+// checkBlob hashes the blob against its ref and records it for the
+// mutation and data checks.
+func (c *checker) checkBlob(ref fixity.Ref) error {
+	c.report.Blobs++
+	c.exists[ref] = true
+
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	rc, err := c.bs.Read(c.ctx, ref)
+	if err != nil {
+		c.problem(KindCorrupt, ref, "%s", readProblem(err))
+		return nil
+	}
+	defer rc.Close()
+
+	br, bt, err := blobreader.BlobType(rc)
+	if err != nil {
+		c.problem(KindCorrupt, ref, "%s", readProblem(err))
+		return nil
+	}
+	var r io.Reader = br
+
+	// only schemas are buffered, schemaless blobs are hashed as they are
+	// read.
+	var buf bytes.Buffer
+	if bt == fixity.BlobTypeMutation || bt == fixity.BlobTypeData {
+		r = io.TeeReader(r, &buf)
+	}
+
+	if msg := verifyHash(ref, r); msg != "" {
+		c.problem(KindCorrupt, ref, "%s", msg)
+		// a corrupt blob cannot be trusted to describe other blobs.
+		return nil
+	}
+
+	b := buf.Bytes()
+
+	// the bytes match the ref, so a schema which fails to decode is
+	// schemaless data beginning with the schema key by chance.
+	switch bt {
+	case fixity.BlobTypeMutation:
+		var m fixity.Mutation
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil
+		}
+		c.mutations[ref] = m
+		c.mutationRefs = append(c.mutationRefs, ref)
+	case fixity.BlobTypeData:
+		var d fixity.DataSchema
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil
+		}
+		c.data[ref] = d
+		c.dataRefs = append(c.dataRefs, ref)
+	}
+
+	return nil
+}
+
+// verifyHash returns a problem message if the blob cannot be read, or if
+// the read bytes do not match the ref.
+func verifyHash(ref fixity.Ref, r io.Reader) string {
+	name, err := ref.HashName()
+	if err != nil {
+		return fmt.Sprintf("undecodable ref: %v", err)
+	}
+
+	digest, err := ref.Digest()
+	if err != nil {
+		return fmt.Sprintf("undecodable ref: %v", err)
+	}
+
+	hasher, err := fixity.Hasher(name)
+	if err != nil {
+		return fmt.Sprintf("unsupported hash: %v", err)
+	}
+
+	if _, err := io.Copy(hasher, r); err != nil {
+		return readProblem(err)
+	}
+
+	if !bytes.Equal(hasher.Sum(nil), digest) {
+		return hashProblem
+	}
+
+	return ""
+}
+
+// hashProblem is the problem message of bytes not matching their ref.
+const hashProblem = "hash does not match ref"
+
+// readProblem returns the problem message of a failed blob read. Reads of
+// a verifying blobstore fail with a *fixity.CorruptBlobError on a hash
+// mismatch.
+func readProblem(err error) string {
+	if _, ok := err.(*fixity.CorruptBlobError); ok {
+		return hashProblem
+	}
+	return fmt.Sprintf("read: %v", err)
+}
+
+func (c *checker) checkMutation(ref fixity.Ref, m fixity.Mutation) {
+	if m.ValuesSchema != "" && !c.exists[m.ValuesSchema] {
+		c.problem(KindDangling, ref, "missing values %q", m.ValuesSchema)
+	}
+
+	if m.DataSchema != "" && !c.exists[m.DataSchema] {
+		c.problem(KindDangling, ref, "missing data %q", m.DataSchema)
+	}
+
+	if m.Previous != "" && !c.exists[m.Previous] {
+		c.problem(KindDangling, ref, "missing previous %q", m.Previous)
+	}
+}
+
+// checkData reassembles the data stream, verifying the parts exist and
+// that the size and checksum match the DataSchema.
+func (c *checker) checkData(ref fixity.Ref, d fixity.DataSchema) error {
+	c.report.Data++
+
+	name, err := ref.HashName()
+	if err != nil {
+		// already reported as a corrupt blob.
+		return nil
+	}
+
+	hasher, err := fixity.Hasher(name)
+	if err != nil {
+		return nil
+	}
+
+	var (
+		size     int64
+		complete = true
+	)
+	if err := c.checkParts(ref, d.PartsSchema, hasher, &size, &complete); err != nil {
+		return err // no wrap helper err
+	}
+
+	// the size and checksum of incomplete data are meaningless.
+	if !complete {
+		return nil
+	}
+
+	if size != d.Size {
+		c.problem(KindData, ref, "size %d does not match dataschema size %d", size, d.Size)
+	}
+
+	if checksum := hex.EncodeToString(hasher.Sum(nil)); checksum != d.Checksum {
+		c.problem(KindData, ref, "checksum %s does not match dataschema checksum %s", checksum, d.Checksum)
+	}
+
+	return nil
+}
+
+// checkParts reassembles the parts of both the tree and legacy linked
+// layouts into the hasher, marking the data incomplete if parts are
+// missing.
+func (c *checker) checkParts(partsRef fixity.Ref, parts fixity.PartsSchema,
+	hasher io.Writer, size *int64, complete *bool) error {
+
+	for {
+		if parts.Sizes != nil && len(parts.Sizes) != len(parts.Parts) {
+			c.problem(KindData, partsRef, "%d sizes for %d parts", len(parts.Sizes), len(parts.Parts))
+		}
+
+		for i, part := range parts.Parts {
+			if !c.exists[part] {
+				c.problem(KindDangling, partsRef, "missing part %q", part)
+				*complete = false
+				continue
+			}
+
+			start := *size
+			if parts.Height > 0 {
+				var child fixity.PartsSchema
+				if err := blobstore.ReadAndUnmarshal(c.ctx, c.bs, part, &child); err != nil {
+					c.problem(KindCorrupt, part, "invalid partsschema: %v", err)
+					*complete = false
+					continue
+				}
+				if child.Height != parts.Height-1 {
+					c.problem(KindData, part, "height %d, want %d", child.Height, parts.Height-1)
+					*complete = false
+					continue
+				}
+				if err := c.checkParts(part, child, hasher, size, complete); err != nil {
+					return err // no wrap recursive err
+				}
+			} else {
+				n, err := c.copyBlob(hasher, part)
+				*size += n
+				if err != nil {
+					if !c.corrupt[part] {
+						c.problem(KindCorrupt, part, "%s", readProblem(err))
+					}
+					*complete = false
+					continue
+				}
+			}
+
+			if n := *size - start; i < len(parts.Sizes) && parts.Sizes[i] != n && *complete {
+				c.problem(KindData, partsRef, "part %q size %d does not match recorded size %d", part, n, parts.Sizes[i])
+			}
+		}
+
+		if parts.MoreParts == nil {
+			return nil
+		}
+
+		moreRef := *parts.MoreParts
+		if !c.exists[moreRef] {
+			c.problem(KindDangling, partsRef, "missing more parts %q", moreRef)
+			*complete = false
+			return nil
+		}
+
+		parts = fixity.PartsSchema{}
+		if err := blobstore.ReadAndUnmarshal(c.ctx, c.bs, moreRef, &parts); err != nil {
+			c.problem(KindCorrupt, moreRef, "invalid partsschema: %v", err)
+			*complete = false
+			return nil
+		}
+		partsRef = moreRef
+	}
+}
+
+func (c *checker) copyBlob(w io.Writer, ref fixity.Ref) (int64, error) {
+	rc, err := c.bs.Read(c.ctx, ref)
+	if err != nil {
+		return 0, err // no wrap, see readProblem
+	}
+	defer rc.Close()
+
+	return io.Copy(w, rc)
+}
+
+func (c *checker) checkIndexEntry(m fixity.Match) error {
+	c.report.Index++
+
+	if !c.exists[m.Ref] {
+		c.problem(KindIndex, m.Ref, "index entry of id %q points to a missing mutation", m.ID)
+		return nil
+	}
+
+	if _, ok := c.mutations[m.Ref]; !ok {
+		c.problem(KindIndex, m.Ref, "index entry of id %q does not point to a valid mutation", m.ID)
+	}
+
+	return nil
+}
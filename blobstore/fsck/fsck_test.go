@@ -0,0 +1,273 @@
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/util/wutil"
+)
+
+// corruptStore returns altered bytes for the corrupted refs.
+type corruptStore struct {
+	*memory.Store
+	corrupted map[fixity.Ref]bool
+}
+
+func (s corruptStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	if s.corrupted[ref] {
+		return ioutil.NopCloser(bytes.NewReader([]byte("bitrot"))), nil
+	}
+	return s.Store.Read(ctx, ref)
+}
+
+type matchLister []fixity.Match
+
+func (l matchLister) List(fn func(fixity.Match) error) error {
+	for _, m := range l {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeData(t *testing.T, bs *memory.Store, chunks []string, size int64, checksum string) fixity.Ref {
+	ctx := context.Background()
+
+	var chunkRefs []fixity.Ref
+	for _, c := range chunks {
+		ref, err := bs.Write(ctx, []byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunkRefs = append(chunkRefs, ref)
+	}
+
+	refs, _, err := wutil.WriteData(ctx, bs, chunkRefs, nil, size, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return refs[len(refs)-1]
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	bs := corruptStore{Store: memory.New(), corrupted: map[fixity.Ref]bool{}}
+
+	// blake2b-256 of "foobar".
+	const checksum = "93a0e84a8cdd4166267dbe1263e937f08087723ac24e7dcc35b3d5941775ef47"
+
+	goodRef := writeData(t, bs.Store, []string{"foo", "bar"}, 6, checksum)
+	mutRef, err := wutil.MarshalAndWrite(ctx, bs, fixity.Mutation{
+		Schema: fixity.Schema{
+			SchemaType: fixity.BlobTypeMutation,
+		},
+		ID:         "good",
+		DataSchema: goodRef,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// schemaless data which is sniffed as a mutation.
+	if _, err := bs.Write(ctx, []byte(`{"_fixitySchema":4,"id":5}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(ctx, bs, matchLister{{ID: "good", Ref: mutRef}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Damaged() {
+		t.Fatalf("want no problems, got: %v", report.Problems)
+	}
+
+	missing, err := fixity.Hash([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizeRef := writeData(t, bs.Store, []string{"foo", "bar"}, 7, checksum)
+	danglingRefs, _, err := wutil.WriteData(ctx, bs, []fixity.Ref{missing}, nil, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	danglingRef := danglingRefs[len(danglingRefs)-1]
+	corruptRef, err := bs.Write(ctx, []byte("corrupt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.corrupted[corruptRef] = true
+
+	report, err = Check(ctx, bs, matchLister{{ID: "gone", Ref: missing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[Problem]bool{}
+	for _, p := range report.Problems {
+		want[Problem{Kind: p.Kind, Ref: p.Ref}] = true
+	}
+	for _, p := range []Problem{
+		{Kind: KindData, Ref: sizeRef},
+		{Kind: KindDangling, Ref: danglingRef},
+		{Kind: KindCorrupt, Ref: corruptRef},
+		{Kind: KindIndex, Ref: missing},
+	} {
+		if !want[p] {
+			t.Errorf("missing problem %s %s, got: %v", p.Kind, p.Ref, report.Problems)
+		}
+	}
+	if len(report.Problems) != 4 {
+		t.Errorf("want:4 problems, got: %v", report.Problems)
+	}
+}
+
+func TestCheckTree(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	hasher, err := fixity.Hasher(fixity.DefaultMultihashName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		refs  []fixity.Ref
+		sizes []int64
+		size  int64
+	)
+	for i := 0; i < 250; i++ {
+		c := []byte(fmt.Sprintf("chunk %d;", i))
+		ref, err := bs.Write(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hasher.Write(c)
+		refs = append(refs, ref)
+		sizes = append(sizes, int64(len(c)))
+		size += int64(len(c))
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	_, data, err := wutil.WriteData(ctx, bs, refs, sizes, size, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Height != 1 {
+		t.Fatalf("want height:1, got:%d", data.Height)
+	}
+
+	report, err := Check(ctx, bs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Damaged() || report.Data != 1 {
+		t.Fatalf("want 1 undamaged data, got:%d data and problems: %v", report.Data, report.Problems)
+	}
+
+	// misrecord the size of the first chunk.
+	sizes[0]++
+	if _, _, err := wutil.WriteData(ctx, bs, refs, sizes, size+1, checksum); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Check(ctx, bs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first leaf node, its subtree size in the root, and the total
+	// size of the dataschema.
+	if len(report.Problems) != 3 {
+		t.Errorf("want:3 problems, got: %v", report.Problems)
+	}
+	for _, p := range report.Problems {
+		if p.Kind != KindData {
+			t.Errorf("want data problems, got: %v", p)
+		}
+	}
+}
+
+// failStore fails reads of the failed refs, either on Read or part way
+// through reading the blob.
+type failStore struct {
+	*memory.Store
+	failRead, failCopy map[fixity.Ref]bool
+}
+
+func (s failStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	if s.failRead[ref] {
+		return nil, errors.New("disk on fire")
+	}
+	rc, err := s.Store.Read(ctx, ref)
+	if err != nil || !s.failCopy[ref] {
+		return rc, err
+	}
+	return ioutil.NopCloser(io.MultiReader(io.LimitReader(rc, 1), errReader{})), nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("bad sector") }
+
+func TestCheckReadErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		Name string
+		// Wrap is the blobstore given to Check.
+		Wrap func(failStore) Blobstore
+		Fail func(s failStore, ref fixity.Ref)
+	}{
+		{"read", func(s failStore) Blobstore { return s },
+			func(s failStore, ref fixity.Ref) { s.failRead[ref] = true }},
+		{"copy", func(s failStore) Blobstore { return s },
+			func(s failStore, ref fixity.Ref) { s.failCopy[ref] = true }},
+		{"verified", func(s failStore) Blobstore {
+			return fixity.NewVerifyBlobstore(corruptStore{Store: s.Store, corrupted: s.failRead}).(Blobstore)
+		}, func(s failStore, ref fixity.Ref) { s.failRead[ref] = true }},
+	}
+
+	for _, test := range tests {
+		bs := failStore{
+			Store:    memory.New(),
+			failRead: map[fixity.Ref]bool{},
+			failCopy: map[fixity.Ref]bool{},
+		}
+
+		writeData(t, bs.Store, []string{"foo", "bar", "baz"}, 9, "")
+		barRef, err := fixity.Hash([]byte("bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Fail(bs, barRef)
+
+		report, err := Check(ctx, test.Wrap(bs), nil)
+		if err != nil {
+			t.Fatalf("%s: want problems recorded, got:%v", test.Name, err)
+		}
+
+		// the unreadable part is corrupt, and the data is incomplete
+		// rather than mismatched.
+		if len(report.Problems) != 1 {
+			t.Fatalf("%s: want 1 problem, got:%v", test.Name, report.Problems)
+		}
+		if p := report.Problems[0]; p.Kind != KindCorrupt || p.Ref != barRef {
+			t.Errorf("%s: want corrupt %s, got:%v", test.Name, barRef, p)
+		}
+		if report.Data != 1 || report.Blobs != 4 {
+			t.Errorf("%s: want 4 blobs and 1 data checked, got:%d and %d",
+				test.Name, report.Blobs, report.Data)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package gc implements mark and sweep garbage collection of blobs that
+// are not reachable from any indexed mutation.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/value"
+)
+
+// DefaultGracePeriod is the default age a blob must reach before it can be
+// swept, allowing in-flight writes to finish writing their mutation.
+const DefaultGracePeriod = time.Hour
+
+// ErrNoIndexedMutations is returned when mutations exist but none of them
+// are indexed, such as with an empty or wrong index, which would sweep
+// every blob.
+var ErrNoIndexedMutations = errors.New("no indexed mutations found")
+
+// Blobstore is the set of Blobstore interfaces required to collect.
+type Blobstore interface {
+	fixity.BlobReader
+	fixity.BlobLister
+	fixity.BlobStater
+	fixity.BlobDeleter
+}
+
+type Config struct {
+	// DryRun reports the blobs that would be swept, without deleting them.
+	DryRun bool
+
+	// GracePeriod is the age a blob must reach before it can be swept.
+	//
+	// Chunks of a write are stored before the mutation that references
+	// them, so this protects the blobs of in-flight writes.
+	GracePeriod time.Duration
+
+	// Force sweeps even if none of the mutations are indexed.
+	Force bool
+}
+
+type Report struct {
+	// Marked is the number of blobs reachable from indexed mutations.
+	Marked int
+
+	// Swept are the unreachable blobs that were deleted, or would be
+	// deleted if DryRun.
+	Swept []fixity.Ref
+
+	// SweptSize is the total bytes of the swept blobs.
+	SweptSize int64
+
+	// Young is the number of unreachable blobs which were skipped due to
+	// the grace period.
+	Young int
+
+	// Unreadable are the blobs which could not be read while marking.
+	// They are never swept, but blobs only reachable from them may be.
+	Unreadable []fixity.Ref
+}
+
+// Collect marks all blobs reachable from indexed mutations and sweeps the
+// rest.
+//
+// Reachable blobs are the indexed mutations, their previous mutations,
+// values, data, parts and chunks.
+func Collect(ctx context.Context, bs Blobstore, qr index.Querier, c Config) (Report, error) {
+	// the cutoff is recorded before marking, so that anything written
+	// during the collection is protected by the grace period.
+	cutoff := time.Now().Add(-c.GracePeriod)
+
+	var (
+		report    Report
+		mutations int
+		marked    = map[fixity.Ref]bool{}
+		// unreadable blobs are kept, the same as marked blobs.
+		unreadable = map[fixity.Ref]bool{}
+	)
+	err := bs.List(ctx, "", func(ref fixity.Ref) error {
+		if marked[ref] {
+			return nil
+		}
+
+		m, ok, err := blobstore.ReadMutation(ctx, bs, ref)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			unreadable[ref] = true
+			report.Unreadable = append(report.Unreadable, ref)
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+		mutations++
+
+		indexed, err := isIndexed(qr, ref)
+		if err != nil {
+			return fmt.Errorf("isindexed %q: %v", ref, err)
+		}
+		if !indexed {
+			return nil
+		}
+
+		if err := markMutation(ctx, bs, marked, ref, m); err != nil {
+			return fmt.Errorf("mark %q: %v", ref, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("mark: %v", err)
+	}
+
+	report.Marked = len(marked)
+
+	if report.Marked == 0 && mutations > 0 && !c.Force && !c.DryRun {
+		return Report{}, ErrNoIndexedMutations
+	}
+
+	// block writes while sweeping, if supported, so that a blob cannot be
+	// reused by a write between being checked and deleted.
+	if l, ok := bs.(fixity.BlobWriteLocker); ok && !c.DryRun {
+		unlock, err := l.LockWrites()
+		if err != nil && err != fixity.ErrNotSupported {
+			return Report{}, fmt.Errorf("lockwrites: %v", err)
+		}
+		if err == nil {
+			defer unlock()
+		}
+	}
+
+	err = bs.List(ctx, "", func(ref fixity.Ref) error {
+		if marked[ref] || unreadable[ref] {
+			return nil
+		}
+
+		info, err := bs.Stat(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("stat %q: %v", ref, err)
+		}
+
+		if info.ModTime.After(cutoff) {
+			report.Young++
+			return nil
+		}
+
+		if !c.DryRun {
+			if err := bs.Delete(ctx, ref); err != nil {
+				return fmt.Errorf("delete %q: %v", ref, err)
+			}
+		}
+
+		report.Swept = append(report.Swept, ref)
+		report.SweptSize += info.Size
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("sweep: %v", err)
+	}
+
+	return report, nil
+}
+
+func isIndexed(qr index.Querier, ref fixity.Ref) (bool, error) {
+	matches, err := qr.Query(q.New().WithVersions().Eq(index.FRefKey, value.String(string(ref))))
+	if err != nil {
+		return false, fmt.Errorf("query: %v", err)
+	}
+
+	return len(matches) != 0, nil
+}
+
+// markMutation marks the mutation and every blob reachable from it.
+func markMutation(ctx context.Context, bs fixity.BlobReader,
+	marked map[fixity.Ref]bool, ref fixity.Ref, m fixity.Mutation) error {
+
+	for {
+		marked[ref] = true
+
+		if m.ValuesSchema != "" {
+			marked[m.ValuesSchema] = true
+		}
+
+		if m.DataSchema != "" && !marked[m.DataSchema] {
+			if err := markData(ctx, bs, marked, m.DataSchema); err != nil {
+				return fmt.Errorf("data %q: %v", m.DataSchema, err)
+			}
+		}
+
+		// follow the history of the mutation, as it may not be indexed.
+		if m.Previous == "" || marked[m.Previous] {
+			return nil
+		}
+
+		ref = m.Previous
+		m = fixity.Mutation{}
+		if err := blobstore.ReadAndUnmarshal(ctx, bs, ref, &m); err != nil {
+			return fmt.Errorf("previous %q: %v", ref, err)
+		}
+	}
+}
+
+// markData marks the data schema, its parts schemas and all chunks.
+func markData(ctx context.Context, bs fixity.BlobReader,
+	marked map[fixity.Ref]bool, dataRef fixity.Ref) error {
+
+	var data fixity.DataSchema
+	if err := blobstore.ReadAndUnmarshal(ctx, bs, dataRef, &data); err != nil {
+		return fmt.Errorf("readandunmarshal: %v", err)
+	}
+	marked[dataRef] = true
+
+	return markParts(ctx, bs, marked, data.PartsSchema)
+}
+
+// markParts marks the parts of both the tree and legacy linked layouts.
+func markParts(ctx context.Context, bs fixity.BlobReader,
+	marked map[fixity.Ref]bool, parts fixity.PartsSchema) error {
+
+	for {
+		for _, ref := range parts.Parts {
+			marked[ref] = true
+
+			if parts.Height == 0 {
+				continue
+			}
+
+			var child fixity.PartsSchema
+			if err := blobstore.ReadAndUnmarshal(ctx, bs, ref, &child); err != nil {
+				return fmt.Errorf("readandunmarshal parts %q: %v", ref, err)
+			}
+			if child.Height != parts.Height-1 {
+				return fmt.Errorf("parts %q height %d, want %d", ref, child.Height, parts.Height-1)
+			}
+			if err := markParts(ctx, bs, marked, child); err != nil {
+				return err // no wrap recursive err
+			}
+		}
+
+		if parts.MoreParts == nil {
+			return nil
+		}
+
+		partsRef := *parts.MoreParts
+		parts = fixity.PartsSchema{}
+		if err := blobstore.ReadAndUnmarshal(ctx, bs, partsRef, &parts); err != nil {
+			return fmt.Errorf("readandunmarshal parts %q: %v", partsRef, err)
+		}
+		marked[partsRef] = true
+	}
+}
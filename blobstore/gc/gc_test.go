@@ -0,0 +1,181 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/util/wutil"
+	"github.com/leeola/fixity/value"
+)
+
+// refQuerier is a minimal index.Querier matching indexed refs.
+type refQuerier map[fixity.Ref]bool
+
+func (qr refQuerier) Query(qu q.Query) ([]fixity.Match, error) {
+	ref := fixity.Ref(qu.Constraint.Value.StringValue)
+	if !qr[ref] {
+		return nil, nil
+	}
+	return []fixity.Match{{Ref: ref}}, nil
+}
+
+// unreadableStore fails to read the given refs.
+type unreadableStore struct {
+	*memory.Store
+	refs map[fixity.Ref]bool
+}
+
+func (s unreadableStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	if s.refs[ref] {
+		return nil, errors.New("unreadable")
+	}
+	return s.Store.Read(ctx, ref)
+}
+
+func writeMutation(t *testing.T, bs *memory.Store, id string, chunks []string, previous fixity.Ref) []fixity.Ref {
+	ctx := context.Background()
+
+	var chunkRefs []fixity.Ref
+	for _, c := range chunks {
+		ref, err := bs.Write(ctx, []byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunkRefs = append(chunkRefs, ref)
+	}
+
+	refs, _, err := wutil.WriteData(ctx, bs, chunkRefs, nil, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valuesRef, err := wutil.WriteValues(ctx, bs, fixity.Values{"id": value.String(id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs = append(refs, valuesRef)
+
+	ref, err := wutil.MarshalAndWrite(ctx, bs, fixity.Mutation{
+		Schema: fixity.Schema{
+			SchemaType: fixity.BlobTypeMutation,
+		},
+		ID:           id,
+		DataSchema:   refs[len(refs)-2],
+		ValuesSchema: valuesRef,
+		Previous:     previous,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(refs, ref)
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	v1 := writeMutation(t, bs, "foo", []string{"a", "b"}, "")
+	v2 := writeMutation(t, bs, "foo", []string{"a", "c"}, v1[len(v1)-1])
+	orphan := writeMutation(t, bs, "bar", []string{"d", "e"}, "")
+
+	qr := refQuerier{v2[len(v2)-1]: true}
+
+	report, err := Collect(ctx, bs, qr, Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// d, e, the data, values and mutation of bar.
+	if len(report.Swept) != 5 {
+		t.Fatalf("want:5 swept, got:%d", len(report.Swept))
+	}
+	for _, ref := range orphan {
+		if _, err := bs.Stat(ctx, ref); err != nil {
+			t.Errorf("dry run deleted %q: %v", ref, err)
+		}
+	}
+
+	report, err = Collect(ctx, bs, qr, Config{GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Swept) != 0 || report.Young != 5 {
+		t.Errorf("want:0 swept and 5 young, got:%d swept and %d young",
+			len(report.Swept), report.Young)
+	}
+
+	if _, err := Collect(ctx, bs, qr, Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range append(v1, v2...) {
+		if _, err := bs.Stat(ctx, ref); err != nil {
+			t.Errorf("reachable blob %q swept: %v", ref, err)
+		}
+	}
+	for _, ref := range orphan {
+		if _, err := bs.Stat(ctx, ref); err == nil {
+			t.Errorf("unreachable blob %q not swept", ref)
+		}
+	}
+}
+
+func TestCollectUnindexed(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	refs := writeMutation(t, bs, "foo", []string{"a"}, "")
+
+	if _, err := Collect(ctx, bs, refQuerier{}, Config{}); err != ErrNoIndexedMutations {
+		t.Fatalf("want err:%q, got:%v", ErrNoIndexedMutations, err)
+	}
+	for _, ref := range refs {
+		if _, err := bs.Stat(ctx, ref); err != nil {
+			t.Errorf("blob %q swept: %v", ref, err)
+		}
+	}
+
+	report, err := Collect(ctx, bs, refQuerier{}, Config{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Swept) != len(refs) {
+		t.Errorf("want:%d swept, got:%d", len(refs), len(report.Swept))
+	}
+}
+
+func TestCollectUnreadable(t *testing.T) {
+	ctx := context.Background()
+	ms := memory.New()
+
+	refs := writeMutation(t, ms, "foo", []string{"a"}, "")
+	bad, err := ms.Write(ctx, []byte("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs := unreadableStore{Store: ms, refs: map[fixity.Ref]bool{bad: true}}
+	qr := refQuerier{refs[len(refs)-1]: true}
+
+	report, err := Collect(ctx, bs, qr, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Unreadable) != 1 || report.Unreadable[0] != bad {
+		t.Errorf("want unreadable:[%s], got:%v", bad, report.Unreadable)
+	}
+	if len(report.Swept) != 0 {
+		t.Errorf("want:0 swept, got:%v", report.Swept)
+	}
+	if _, err := ms.Stat(ctx, bad); err != nil {
+		t.Errorf("unreadable blob swept: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 
 	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/reader/blobreader"
 )
 
 func ReadAndUnmarshal(ctx context.Context, r fixity.BlobReader, ref fixity.Ref, v interface{}) error {
@@ -27,3 +28,36 @@ func ReadAndUnmarshal(ctx context.Context, r fixity.BlobReader, ref fixity.Ref,
 
 	return nil
 }
+
+// ReadMutation returns the mutation of the given ref, if the blob is a
+// mutation.
+func ReadMutation(ctx context.Context, r fixity.BlobReader, ref fixity.Ref) (fixity.Mutation, bool, error) {
+	rc, err := r.Read(ctx, ref)
+	if err != nil {
+		return fixity.Mutation{}, false, fmt.Errorf("blobstore read: %v", err)
+	}
+	defer rc.Close()
+
+	br, bt, err := blobreader.BlobType(rc)
+	if err != nil {
+		return fixity.Mutation{}, false, fmt.Errorf("blobtype: %v", err)
+	}
+
+	if bt != fixity.BlobTypeMutation {
+		return fixity.Mutation{}, false, nil
+	}
+
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		return fixity.Mutation{}, false, fmt.Errorf("readall: %v", err)
+	}
+
+	// schemaless data can begin with the schema key by chance, and is only
+	// told apart from a mutation by failing to decode.
+	var m fixity.Mutation
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fixity.Mutation{}, false, nil
+	}
+
+	return m, true, nil
+}
@@ -0,0 +1,55 @@
+package blobstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/util/wutil"
+)
+
+func TestReadMutation(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	mutRef, err := wutil.MarshalAndWrite(ctx, bs, fixity.Mutation{
+		Schema: fixity.Schema{SchemaType: fixity.BlobTypeMutation},
+		ID:     "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Blob string
+		Ref  fixity.Ref
+		Want bool
+	}{
+		{Ref: mutRef, Want: true},
+		{Blob: "foo"},
+		// schemaless data sniffed as a mutation.
+		{Blob: `{"_fixitySchema":4,"id":5}`},
+		{Blob: `{"_fixitySchema":4,"id":"foo"} trailing`},
+	}
+	for _, test := range tests {
+		ref := test.Ref
+		if ref == "" {
+			ref, err = bs.Write(ctx, []byte(test.Blob))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		m, ok, err := ReadMutation(ctx, bs, ref)
+		if err != nil {
+			t.Fatalf("%q: %v", test.Blob, err)
+		}
+		if ok != test.Want {
+			t.Errorf("%q want mutation:%t, got:%t", test.Blob, test.Want, ok)
+		}
+		if ok && m.ID != "foo" {
+			t.Errorf("want mutation of foo, got:%q", m.ID)
+		}
+	}
+}
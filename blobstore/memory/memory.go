@@ -3,25 +3,29 @@ package memory
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	base58 "github.com/jbenet/go-base58"
 	"github.com/leeola/fixity"
-	blake2b "github.com/minio/blake2b-simd"
 )
 
 // Store is a memory store used for testing.
 type Store struct {
-	mu sync.Mutex
-	m  map[fixity.Ref][]byte
+	mu    sync.Mutex
+	m     map[fixity.Ref][]byte
+	times map[fixity.Ref]time.Time
 }
 
 func New() *Store {
 	return &Store{
-		m: map[fixity.Ref][]byte{},
+		m:     map[fixity.Ref][]byte{},
+		times: map[fixity.Ref]time.Time{},
 	}
 }
 
@@ -38,11 +42,70 @@ func (s *Store) Read(_ context.Context, ref fixity.Ref) (io.ReadCloser, error) {
 }
 
 func (s *Store) Write(_ context.Context, b []byte) (fixity.Ref, error) {
+	// hashed before locking, allowing concurrent writes to hash in parallel.
+	ref, err := fixity.Hash(b)
+	if err != nil {
+		return "", fmt.Errorf("hash: %v", err)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	hB := blake2b.Sum256(b)
-	ref := fixity.Ref(base58.Encode(hB[:]))
 	s.m[ref] = b
+	s.times[ref] = time.Now()
 	return ref, nil
 }
+
+func (s *Store) Delete(_ context.Context, ref fixity.Ref) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.m, ref)
+	delete(s.times, ref)
+	return nil
+}
+
+func (s *Store) Stat(_ context.Context, ref fixity.Ref) (fixity.BlobInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.m[ref]
+	if !ok {
+		return fixity.BlobInfo{}, os.ErrNotExist
+	}
+
+	return fixity.BlobInfo{
+		Size:    int64(len(b)),
+		ModTime: s.times[ref],
+	}, nil
+}
+
+// List implements fixity.BlobLister.
+func (s *Store) List(ctx context.Context, after fixity.Ref, fn func(fixity.Ref) error) error {
+	cursor := base58.Decode(string(after))
+
+	s.mu.Lock()
+	refs := make([]fixity.Ref, 0, len(s.m))
+	for ref := range s.m {
+		if bytes.Compare(base58.Decode(string(ref)), cursor) > 0 {
+			refs = append(refs, ref)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(refs, func(i, j int) bool {
+		return bytes.Compare(base58.Decode(string(refs[i])), base58.Decode(string(refs[j]))) < 0
+	})
+
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package fastcdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/leeola/fixity/chunk"
+	"github.com/leeola/fixity/config"
+)
+
+const configType = "fastcdc"
+
+func init() {
+	chunk.Register(configType, chunk.ConstructorFunc(Constructor))
+}
+
+// Constructor returns a Chunker of the DefaultConfig of the average size,
+// with any sizes of the type specific Config overriding the defaults.
+func Constructor(r io.Reader, cc config.ChunkerConfig) (chunk.Chunker, error) {
+	avgSize := DefaultAverageChunkSize
+	if cc.AverageSize > 0 {
+		avgSize = cc.AverageSize
+	}
+
+	c := DefaultConfig(avgSize)
+	if len(cc.Config) > 0 {
+		if err := json.Unmarshal(cc.Config, &c); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %v", err)
+		}
+	}
+
+	return New(r, c)
+}
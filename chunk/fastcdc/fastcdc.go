@@ -0,0 +1,181 @@
+// Package fastcdc implements FastCDC content defined chunking, using a gear
+// rolling hash with normalized chunking.
+//
+// See "FastCDC: a Fast and Efficient Content-Defined Chunking Approach for
+// Data Deduplication", Xia et al.
+package fastcdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/leeola/fixity/chunk"
+)
+
+const (
+	// DefaultAverageChunkSize is the average chunk size, 1MiB, matching the
+	// resticfork default.
+	DefaultAverageChunkSize = 1024 * 1024
+
+	// MinimumChunkSize is the smallest allowed MinSize.
+	MinimumChunkSize = 64
+
+	// normalization is the number of bits the masks before and after the
+	// average size differ from the average size bits, narrowing the chunk
+	// size distribution around the average.
+	normalization = 2
+)
+
+// Config of the chunk sizes. Chunks are never smaller than MinSize, except
+// for the last chunk, and never larger than MaxSize.
+type Config struct {
+	MinSize int `json:"minSize"`
+	AvgSize int `json:"avgSize"`
+	MaxSize int `json:"maxSize"`
+}
+
+// DefaultConfig returns a Config for the given average size, with a minimum
+// of a quarter and a maximum of four times the average.
+func DefaultConfig(avgSize int) Config {
+	return Config{
+		MinSize: avgSize / 4,
+		AvgSize: avgSize,
+		MaxSize: avgSize * 4,
+	}
+}
+
+// Chunker implements chunk.Chunker with FastCDC.
+//
+// The bytes of a returned chunk are only valid until the next call to
+// Chunk.
+type Chunker struct {
+	r   io.Reader
+	c   Config
+	buf []byte
+	// start and end are the bounds of the unchunked bytes within buf.
+	start, end int
+	eof        bool
+
+	maskS, maskL uint64
+}
+
+func New(r io.Reader, c Config) (*Chunker, error) {
+	if r == nil {
+		return nil, errors.New("missing Reader")
+	}
+
+	if c.MinSize < MinimumChunkSize {
+		return nil, fmt.Errorf("minSize %d below %d", c.MinSize, MinimumChunkSize)
+	}
+	if c.AvgSize < c.MinSize || c.MaxSize < c.AvgSize {
+		return nil, fmt.Errorf("sizes must be min <= avg <= max, got %d, %d, %d",
+			c.MinSize, c.AvgSize, c.MaxSize)
+	}
+
+	// the number of bits of the closest power of two to the average.
+	avgBits := bits.Len(uint(c.AvgSize)) - 1
+	if c.AvgSize-(1<<uint(avgBits)) > (1<<uint(avgBits+1))-c.AvgSize {
+		avgBits++
+	}
+
+	return &Chunker{
+		r:     r,
+		c:     c,
+		buf:   make([]byte, 2*c.MaxSize),
+		maskS: mask(avgBits + normalization),
+		maskL: mask(avgBits - normalization),
+	}, nil
+}
+
+// mask returns a mask of the n highest bits, which depend on the most
+// recent 64 bytes rolled into the gear hash.
+func mask(n int) uint64 {
+	if n < 1 {
+		n = 1
+	}
+	return ^uint64(0) << uint(64-n)
+}
+
+func (c *Chunker) Chunk(ctx context.Context) (chunk.Chunk, error) {
+	if err := ctx.Err(); err != nil {
+		return chunk.Chunk{}, err
+	}
+
+	if err := c.fill(); err != nil {
+		return chunk.Chunk{}, fmt.Errorf("fill: %v", err)
+	}
+
+	if c.start == c.end {
+		return chunk.Chunk{}, io.EOF
+	}
+
+	n := c.cut(c.buf[c.start:c.end])
+	b := c.buf[c.start : c.start+n]
+	c.start += n
+
+	return chunk.Chunk{
+		Bytes: b,
+		Size:  int64(n),
+	}, nil
+}
+
+// fill reads until at least MaxSize bytes are unchunked, or the reader is
+// exhausted.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.c.MaxSize {
+		return nil
+	}
+
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err // no wrap, the reader is the caller's
+		}
+	}
+
+	return nil
+}
+
+// cut returns the length of the next chunk of b.
+func (c *Chunker) cut(b []byte) int {
+	n := len(b)
+	if n <= c.c.MinSize {
+		return n
+	}
+	if n > c.c.MaxSize {
+		n = c.c.MaxSize
+	}
+
+	normal := c.c.AvgSize
+	if normal > n {
+		normal = n
+	}
+
+	var h uint64
+	i := c.c.MinSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gear[b[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gear[b[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+
+	return n
+}
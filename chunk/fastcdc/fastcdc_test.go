@@ -0,0 +1,139 @@
+package fastcdc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"testing"
+)
+
+// randomBytes returns deterministic pseudo random bytes, independent of
+// math/rand.
+func randomBytes(seed uint64, n int) []byte {
+	b := make([]byte, n)
+	x := seed
+	for i := range b {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		b[i] = byte(x)
+	}
+	return b
+}
+
+func chunkAll(t *testing.T, b []byte, c Config) [][]byte {
+	chunker, err := New(bytes.NewReader(b), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks [][]byte
+	for {
+		ch, err := chunker.Chunk(context.Background())
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.Size != int64(len(ch.Bytes)) {
+			t.Fatalf("want size:%d, got:%d", len(ch.Bytes), ch.Size)
+		}
+		chunks = append(chunks, append([]byte(nil), ch.Bytes...))
+	}
+}
+
+func TestChunkSizes(t *testing.T) {
+	c := DefaultConfig(8 * 1024)
+	b := randomBytes(1, 4*1024*1024)
+
+	chunks := chunkAll(t, b, c)
+
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, b) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+
+	for i, ch := range chunks {
+		if len(ch) > c.MaxSize {
+			t.Errorf("chunk %d size %d above max %d", i, len(ch), c.MaxSize)
+		}
+		if len(ch) < c.MinSize && i != len(chunks)-1 {
+			t.Errorf("chunk %d size %d below min %d", i, len(ch), c.MinSize)
+		}
+	}
+
+	avg := len(b) / len(chunks)
+	if avg < c.AvgSize/2 || avg > c.AvgSize*2 {
+		t.Errorf("want average near %d, got:%d over %d chunks", c.AvgSize, avg, len(chunks))
+	}
+}
+
+func TestStableBoundaries(t *testing.T) {
+	// the gear table must never change, or all previously written content
+	// would be chunked differently.
+	if gear[0] != 0xc27916dbe48167d6 || gear[255] != 0xec1488f133d04d99 {
+		t.Errorf("gear table changed: %#x, %#x", gear[0], gear[255])
+	}
+
+	chunks := chunkAll(t, randomBytes(2, 256*1024), DefaultConfig(8*1024))
+
+	var sizes []int
+	for _, ch := range chunks {
+		sizes = append(sizes, len(ch))
+	}
+
+	want := []int{
+		9522, 8566, 8406, 7292, 9113, 8925, 14482, 9136, 14186, 9925,
+		10179, 8737, 10874, 8907, 2404, 9417, 8949, 15939, 8550, 8932,
+		8672, 12540, 12712, 8853, 8442, 8506, 9978,
+	}
+	if len(sizes) != len(want) {
+		t.Fatalf("want sizes:%v, got:%v", want, sizes)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Fatalf("want sizes:%v, got:%v", want, sizes)
+		}
+	}
+}
+
+func TestShiftedDedup(t *testing.T) {
+	c := DefaultConfig(8 * 1024)
+	b := randomBytes(3, 2*1024*1024)
+
+	original := map[[sha256.Size]byte]bool{}
+	for _, ch := range chunkAll(t, b, c) {
+		original[sha256.Sum256(ch)] = true
+	}
+
+	for _, shifted := range [][]byte{
+		append(randomBytes(4, 100), b...),
+		b[1000:],
+		append(append(append([]byte(nil), b[:len(b)/2]...), "inserted"...), b[len(b)/2:]...),
+	} {
+		var shared int
+		for _, ch := range chunkAll(t, shifted, c) {
+			if original[sha256.Sum256(ch)] {
+				shared++
+			}
+		}
+
+		// only the chunks around the edit should differ.
+		if shared < len(original)-4 {
+			t.Errorf("want at least %d shared chunks, got:%d", len(original)-4, shared)
+		}
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	for _, c := range []Config{
+		{MinSize: 8, AvgSize: 1024, MaxSize: 4096},
+		{MinSize: 1024, AvgSize: 512, MaxSize: 4096},
+		{MinSize: 256, AvgSize: 1024, MaxSize: 512},
+	} {
+		if _, err := New(bytes.NewReader(nil), c); err == nil {
+			t.Errorf("want error for config %+v", c)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package fastcdc
+
+// gear is the table of random values rolled into the gear hash per byte.
+//
+// The table is generated from a fixed seed with splitmix64, rather than
+// math/rand, so that chunk boundaries are identical across platforms and
+// Go versions.
+var gear [256]uint64
+
+const gearSeed = 0x6669786974794344
+
+func init() {
+	x := uint64(gearSeed)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
@@ -0,0 +1,70 @@
+package chunk
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/leeola/fixity/config"
+)
+
+// DefaultType is the chunker type used when the ChunkerConfig type is
+// empty.
+const DefaultType = "resticfork"
+
+var (
+	registry   map[string]Constructor
+	registryMu sync.Mutex
+)
+
+func init() {
+	registry = map[string]Constructor{}
+}
+
+type Constructor interface {
+	New(r io.Reader, c config.ChunkerConfig) (Chunker, error)
+}
+
+type ConstructorFunc func(io.Reader, config.ChunkerConfig) (Chunker, error)
+
+func Register(chunkerType string, c Constructor) {
+	if chunkerType == "" {
+		panic(fmt.Sprintf("chunkerType cannot be empty"))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[chunkerType]; ok {
+		panic(fmt.Sprintf("already registered chunker: %s", chunkerType))
+	}
+
+	registry[chunkerType] = c
+}
+
+// New returns a Chunker of the reader with the registered chunker of the
+// config type.
+func New(r io.Reader, c config.ChunkerConfig) (Chunker, error) {
+	chunkerType := c.Type
+	if chunkerType == "" {
+		chunkerType = DefaultType
+	}
+
+	registryMu.Lock()
+	constructor, ok := registry[chunkerType]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("chunker type not found: %q", chunkerType)
+	}
+
+	ch, err := constructor.New(r, c)
+	if err != nil {
+		return nil, fmt.Errorf("chunker constructor %s: %v", chunkerType, err)
+	}
+
+	return ch, nil
+}
+
+func (f ConstructorFunc) New(r io.Reader, c config.ChunkerConfig) (Chunker, error) {
+	return f(r, c)
+}
@@ -0,0 +1,49 @@
+package chunk_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/leeola/fixity/chunk"
+	_ "github.com/leeola/fixity/chunk/fastcdc"
+	_ "github.com/leeola/fixity/chunk/resticfork"
+	"github.com/leeola/fixity/config"
+)
+
+func TestNew(t *testing.T) {
+	b := bytes.Repeat([]byte("fixity chunker registry "), 10000)
+
+	for _, c := range []config.ChunkerConfig{
+		{},
+		{Type: "resticfork", AverageSize: 4096},
+		{Type: "fastcdc", AverageSize: 4096},
+		{Type: "fastcdc", Config: []byte(`{"maxSize":1024}`), AverageSize: 512},
+	} {
+		ch, err := chunk.New(bytes.NewReader(b), c)
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+
+		var got []byte
+		for {
+			c, err := ch.Chunk(context.Background())
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, c.Bytes...)
+		}
+
+		if !bytes.Equal(got, b) {
+			t.Errorf("%+v: chunks do not reassemble the input", c)
+		}
+	}
+
+	if _, err := chunk.New(bytes.NewReader(b), config.ChunkerConfig{Type: "unknown"}); err == nil {
+		t.Error("want error for unknown chunker type")
+	}
+}
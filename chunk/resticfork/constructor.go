@@ -0,0 +1,25 @@
+package resticfork
+
+import (
+	"io"
+
+	"github.com/leeola/fixity/chunk"
+	"github.com/leeola/fixity/config"
+)
+
+const configType = "resticfork"
+
+func init() {
+	chunk.Register(configType, chunk.ConstructorFunc(Constructor))
+}
+
+// Constructor returns the legacy chunker of NewLegacy if no average size
+// is configured, keeping the chunk boundaries of existing stores. Otherwise
+// the chunks average the configured size.
+func Constructor(r io.Reader, c config.ChunkerConfig) (chunk.Chunker, error) {
+	if c.AverageSize <= 0 {
+		return NewLegacy(r)
+	}
+
+	return New(r, uint64(c.AverageSize))
+}
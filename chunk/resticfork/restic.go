@@ -41,15 +41,14 @@ const (
 	// Note that using this medChunkSize is decided via the medCutoff, below.
 	medChunkSize uint64 = 1048576
 
-	// averageBits of 14 is resulting in roughly chunks of 12KiB by default.
+	// minSizeMul of the average chunk size is the minimum chunk size.
 	//
-	// This size should be low enough to allow small writes to be split up,
-	// even at the cost of write performance (within reason).
-	averageBits = 14
-
-	// min is pretty harmless so we should aim for it to be close to the original
-	// value.
-	minSizeMul = 0.9
+	// Boundaries are searched for only after the min size, and are then
+	// found on average every 2^averageBits bytes, where averageBits is
+	// derived from the remaining half of the average chunk size. The
+	// resulting chunks average the requested size, though the max size
+	// pulls the average slightly below it.
+	minSizeMul = 0.5
 
 	// restic chunker puts a hard cap on the max size so this should probably be
 	// quite a bit larger than the desired max.
@@ -65,11 +64,30 @@ const (
 	// depend on the last boundry. So, this value should strike a good
 	// balance between those two issues.
 	maxSizeMul = 3.0
+
+	// MinimumChunkSize is the smallest average chunk size accepted by New.
+	MinimumChunkSize = 64
+
+	// legacyAverageBits and legacyMinSizeMul are the chunking of NewLegacy,
+	// which produces chunks of roughly 0.9MiB regardless of the average
+	// chunk size.
+	legacyAverageBits = 14
+	legacyMinSizeMul  = 0.9
 )
 
+// Chunker chunks with the restic chunker, merging the undersized tail of
+// the data into the chunk preceding it.
+//
+// The Bytes of a returned Chunk are only valid until the next call to
+// Chunk.
 type Chunker struct {
-	buf     []byte
 	chunker *chunker.Chunker
+	minSize uint
+
+	// bufs alternate between the returned chunk and the peeked chunk.
+	bufs     [2][]byte
+	bufIndex int
+	peeked   *chunker.Chunk
 }
 
 func New(r io.Reader, averageChunkSize uint64) (*Chunker, error) {
@@ -77,32 +95,88 @@ func New(r io.Reader, averageChunkSize uint64) (*Chunker, error) {
 		return nil, errors.New("missing Reader")
 	}
 
+	if averageChunkSize < MinimumChunkSize {
+		return nil, fmt.Errorf("average chunk size below minimum of %d: %d",
+			MinimumChunkSize, averageChunkSize)
+	}
+
 	min := uint(math.Floor(float64(averageChunkSize) * minSizeMul))
 	max := uint(math.Floor(float64(averageChunkSize) * maxSizeMul))
 
 	return &Chunker{
-		// does this size matter?
-		buf: make([]byte, 8*1024*1024),
 		chunker: chunker.NewWithConfig(r, chunker.Pol(0x3DA3358B4DC173),
 			chunker.ChunkerConfig{
 				MinSize:     min,
 				MaxSize:     max,
-				AverageBits: averageBits,
+				AverageBits: averageBits(averageChunkSize - uint64(min)),
 			}),
+		minSize: min,
+		bufs: [2][]byte{
+			// room for a max sized chunk, and a merged tail.
+			make([]byte, 0, max+min),
+			make([]byte, 0, max+min),
+		},
 	}, nil
 }
 
-func (c *Chunker) Chunk(_ context.Context) (chunk.Chunk, error) {
+// NewLegacy returns a Chunker of the chunk boundaries written before New
+// honored the average chunk size, so that data written with the default
+// chunker continues to dedup against existing blobs. Undersized tails are
+// not merged.
+func NewLegacy(r io.Reader) (*Chunker, error) {
+	if r == nil {
+		return nil, errors.New("missing Reader")
+	}
 
-	// TODO(leeola): Add a peek method to break out of the loop if the end of the
-	// roller is near. This way we don't create small tailing chunks if possible.
+	min := uint(math.Floor(float64(DefaultAverageChunkSize) * legacyMinSizeMul))
+	max := uint(math.Floor(float64(DefaultAverageChunkSize) * maxSizeMul))
 
-	ch, err := c.chunker.Next(c.buf)
-	if err == io.EOF {
-		return chunk.Chunk{}, err
+	return &Chunker{
+		chunker: chunker.NewWithConfig(r, chunker.Pol(0x3DA3358B4DC173),
+			chunker.ChunkerConfig{
+				MinSize:     min,
+				MaxSize:     max,
+				AverageBits: legacyAverageBits,
+			}),
+		// a zero minSize merges no tails.
+		bufs: [2][]byte{
+			make([]byte, 0, max),
+			make([]byte, 0, max),
+		},
+	}, nil
+}
+
+// averageBits returns the number of bits of the boundary mask, for
+// boundaries found on average every n bytes.
+func averageBits(n uint64) int {
+	return int(math.Floor(math.Log2(float64(n)) + 0.5))
+}
+
+func (c *Chunker) Chunk(_ context.Context) (chunk.Chunk, error) {
+	if c.peeked == nil {
+		ch, err := c.next()
+		if err != nil {
+			return chunk.Chunk{}, err // no wrap helper err, io.EOF is returned as is.
+		}
+		c.peeked = &ch
 	}
-	if err != nil {
-		return chunk.Chunk{}, fmt.Errorf("next: %v", err)
+
+	ch := *c.peeked
+	c.peeked = nil
+
+	// peek at the following chunk, so that an undersized tail can be merged.
+	next, err := c.next()
+	switch {
+	case err == io.EOF:
+	case err != nil:
+		return chunk.Chunk{}, err // no wrap helper err
+	case next.Length < c.minSize:
+		// the restic chunker only produces chunks smaller than the min size
+		// at the end of the data, so this is the tail.
+		ch.Data = append(ch.Data, next.Data...)
+		ch.Length += next.Length
+	default:
+		c.peeked = &next
 	}
 
 	return chunk.Chunk{
@@ -110,3 +184,21 @@ func (c *Chunker) Chunk(_ context.Context) (chunk.Chunk, error) {
 		Size:  int64(ch.Length),
 	}, nil
 }
+
+// next returns the next chunk of the restic chunker, alternating buffers so
+// that the peeked chunk does not overwrite the returned chunk.
+func (c *Chunker) next() (chunker.Chunk, error) {
+	ch, err := c.chunker.Next(c.bufs[c.bufIndex])
+	if err == io.EOF {
+		return chunker.Chunk{}, err
+	}
+	if err != nil {
+		return chunker.Chunk{}, fmt.Errorf("next: %v", err)
+	}
+
+	// keep the buffer if the chunker grew it.
+	c.bufs[c.bufIndex] = ch.Data[:0]
+	c.bufIndex ^= 1
+
+	return ch, nil
+}
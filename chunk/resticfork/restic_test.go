@@ -0,0 +1,186 @@
+package resticfork
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/leeola/chunker"
+	"github.com/leeola/fixity/config"
+)
+
+// chunkAll returns the chunk sizes of the reader, and the chunked bytes if
+// keep is set.
+func chunkAll(t *testing.T, r io.Reader, averageSize uint64, keep bool) ([]int64, []byte) {
+	c, err := New(r, averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		sizes []int64
+		got   []byte
+	)
+	for {
+		ch, err := c.Chunk(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.Size != int64(len(ch.Bytes)) {
+			t.Fatalf("want size:%d, got:%d", len(ch.Bytes), ch.Size)
+		}
+		if keep {
+			got = append(got, ch.Bytes...)
+		}
+		sizes = append(sizes, ch.Size)
+	}
+
+	return sizes, got
+}
+
+// TestChunkSizes documents the distribution of chunk sizes over random
+// data, which should average the requested size without undersized tails.
+func TestChunkSizes(t *testing.T) {
+	averageSizes := []uint64{4 * 1024, 64 * 1024, DefaultAverageChunkSize}
+	if testing.Short() {
+		averageSizes = averageSizes[:2]
+	}
+
+	for _, averageSize := range averageSizes {
+		// enough chunks for the mean to be within a few percent, streamed
+		// rather than held in memory.
+		size := 256*averageSize + averageSize/7
+		r := io.LimitReader(rand.New(rand.NewSource(1)), int64(size))
+
+		sizes, _ := chunkAll(t, r, averageSize, false)
+
+		minSize := int64(float64(averageSize) * minSizeMul)
+		maxSize := int64(float64(averageSize) * maxSizeMul)
+
+		var sum, sumSq, smallest, largest float64
+		smallest = math.MaxFloat64
+		for i, s := range sizes {
+			if s < minSize {
+				t.Errorf("average:%d chunk %d of %d below min size: %d", averageSize, i, len(sizes), s)
+			}
+			// only the last chunk may hold a merged tail beyond the max.
+			if s > maxSize && (i != len(sizes)-1 || s > maxSize+minSize) {
+				t.Errorf("average:%d chunk %d of %d above max size: %d", averageSize, i, len(sizes), s)
+			}
+
+			f := float64(s)
+			sum += f
+			sumSq += f * f
+			smallest = math.Min(smallest, f)
+			largest = math.Max(largest, f)
+		}
+
+		if uint64(sum) != size {
+			t.Errorf("average:%d want total size:%d, got:%.0f", averageSize, size, sum)
+		}
+
+		n := float64(len(sizes))
+		mean := sum / n
+		stddev := math.Sqrt(sumSq/n - mean*mean)
+		t.Logf("average:%d chunks:%d mean:%.0f stddev:%.0f min:%.0f max:%.0f",
+			averageSize, len(sizes), mean, stddev, smallest, largest)
+
+		if ratio := mean / float64(averageSize); ratio < 0.75 || ratio > 1.25 {
+			t.Errorf("average:%d want mean within 25%%, got:%.0f", averageSize, mean)
+		}
+	}
+}
+
+func TestChunkTail(t *testing.T) {
+	const averageSize = 4 * 1024
+
+	rnd := rand.New(rand.NewSource(2))
+	b := make([]byte, 64*averageSize)
+	rnd.Read(b)
+
+	full, got := chunkAll(t, bytes.NewReader(b), averageSize, true)
+	if !bytes.Equal(got, b) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+
+	// a tail shorter than the min size is merged into the last chunk.
+	withTail := append(b, 1, 2, 3)
+	tail, got := chunkAll(t, bytes.NewReader(withTail), averageSize, true)
+	if !bytes.Equal(got, withTail) {
+		t.Fatal("chunks do not reassemble the input with a tail")
+	}
+	if len(tail) != len(full) {
+		t.Fatalf("want %d chunks, got:%d", len(full), len(tail))
+	}
+	if last := tail[len(tail)-1]; last != full[len(full)-1]+3 {
+		t.Errorf("want merged tail size:%d, got:%d", full[len(full)-1]+3, last)
+	}
+
+	// data smaller than the min size is a single chunk.
+	if small, _ := chunkAll(t, bytes.NewReader(b[:100]), averageSize, false); len(small) != 1 || small[0] != 100 {
+		t.Errorf("want a single chunk of 100, got:%v", small)
+	}
+
+	if _, err := New(bytes.NewReader(b), MinimumChunkSize-1); err == nil {
+		t.Error("want error below the minimum chunk size")
+	}
+}
+
+// TestChunkLegacy checks that the legacy chunker produces the boundaries of
+// the unmodified restic chunker, as written by previous versions.
+func TestChunkLegacy(t *testing.T) {
+	content := make([]byte, 5*DefaultAverageChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	rc := chunker.NewWithConfig(bytes.NewReader(content), chunker.Pol(0x3DA3358B4DC173),
+		chunker.ChunkerConfig{
+			MinSize:     uint(math.Floor(float64(DefaultAverageChunkSize) * legacyMinSizeMul)),
+			MaxSize:     uint(math.Floor(float64(DefaultAverageChunkSize) * maxSizeMul)),
+			AverageBits: legacyAverageBits,
+		})
+
+	var want []int64
+	buf := make([]byte, 8*1024*1024)
+	for {
+		ch, err := rc.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, int64(ch.Length))
+	}
+
+	c, err := Constructor(bytes.NewReader(content), config.ChunkerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int64
+	for {
+		ch, err := c.Chunk(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ch.Size)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("want sizes:%v, got:%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want sizes:%v, got:%v", want, got)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/reader/datareader"
 	"github.com/mattn/go-isatty"
 	"github.com/urfave/cli"
 )
@@ -89,6 +90,20 @@ func readToWriters(clictx *cli.Context, wout, werr io.Writer, dataMsg string) er
 		}
 	}
 
+	// verify the data unless the store already does, so that an error is
+	// returned if the printed data does not match the dataschema.
+	if _, ok := r.(*datareader.VerifyReader); r != nil && !ok && !clictx.Bool("no-verify") {
+		r, err = datareader.NewVerifyReader(r)
+		if err != nil {
+			return fmt.Errorf("newverifyreader: %v", err)
+		}
+	}
+
+	// stop the read-ahead of the reader if the copy fails.
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
 	fmt.Fprintln(werr, dataMsg)
 	if _, err := io.Copy(wout, r); err != nil {
 		return fmt.Errorf("copy wout: %v", err)
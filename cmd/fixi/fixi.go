@@ -1,14 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	// import defaults
+	_ "github.com/leeola/fixity/chunk/fastcdc"
 	"github.com/leeola/fixity/config"
 	_ "github.com/leeola/fixity/defaultpkg"
+	_ "github.com/leeola/fixity/index/sqlite"
+	_ "github.com/leeola/fixity/store/signed"
 
 	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/gc"
 	"github.com/urfave/cli"
 )
 
@@ -65,6 +70,61 @@ func main() {
 					Name:  "ref",
 					Usage: "read from mutation refs, not ids",
 				},
+				cli.BoolFlag{
+					Name:  "no-verify",
+					Usage: "do not verify the data size and checksum",
+				},
+			},
+		},
+		{
+			Name:   "fsck",
+			Usage:  "verify the integrity of every blob, data stream and index entry",
+			Action: FsckCmd,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "blobstore",
+					Usage: "blobstore `NAME` to check, defaults to the store blobstore",
+				},
+				cli.StringFlag{
+					Name:  "index",
+					Usage: "index `NAME` to check, defaults to the store index",
+				},
+				cli.BoolFlag{
+					Name:  "no-index",
+					Usage: "do not check index entries",
+				},
+			},
+		},
+		{
+			Name:   "gc",
+			Usage:  "delete blobs unreachable from indexed mutations",
+			Action: GCCmd,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "blobstore",
+					Usage: "blobstore `NAME` to collect, defaults to the store blobstore",
+				},
+				cli.StringFlag{
+					Name:  "index",
+					Usage: "index `NAME` of reachable mutations, defaults to the store index",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print unreachable blobs without deleting them",
+				},
+				cli.DurationFlag{
+					Name:  "grace",
+					Value: gc.DefaultGracePeriod,
+					Usage: "do not delete blobs younger than `DURATION`",
+				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "delete blobs even if no mutations are indexed",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "print deleted blobs",
+				},
 			},
 		},
 		{
@@ -73,7 +133,33 @@ func main() {
 			ArgsUsage: "QUERY",
 			Usage:     "search the store for QUERY",
 			Action:    QueryCmd,
-			Flags:     []cli.Flag{},
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "limit",
+					Value: 10,
+					Usage: "print at most `N` matches, or N per page with --all",
+				},
+				cli.IntFlag{
+					Name:  "offset",
+					Usage: "skip the first `N` matches",
+				},
+				cli.StringFlag{
+					Name:  "after",
+					Usage: "print the matches following `CURSOR`, from a previous query",
+				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "print every match, querying a page at a time",
+				},
+				cli.StringFlag{
+					Name:  "sort",
+					Usage: "sort by comma separated `FIELDS`, prefixed with - to sort descending",
+				},
+				cli.StringFlag{
+					Name:  "fields",
+					Usage: "print comma separated value `FIELDS` and index keys, such as fsize",
+				},
+			},
 		},
 		{
 			Name:      "read",
@@ -102,8 +188,17 @@ func main() {
 					Name:  "ref",
 					Usage: "read from mutation refs, not ids",
 				},
+				cli.BoolFlag{
+					Name:  "no-verify",
+					Usage: "do not verify the data size and checksum",
+				},
 			},
 		},
+		{
+			Name:   "reindex",
+			Usage:  "rebuild the store index from the verified mutations in its blobstore",
+			Action: ReindexCmd,
+		},
 		{
 			Name:      "write",
 			Aliases:   []string{"w"},
@@ -130,6 +225,10 @@ func main() {
 					Name:  "allow-unsafe",
 					Usage: "allow previewing schemaless bytes",
 				},
+				cli.IntFlag{
+					Name:  "avg-chunk-size",
+					Usage: "average chunk size in `BYTES`, overriding the store chunker size",
+				},
 			},
 			Action: WriteCmd,
 		},
@@ -144,3 +243,34 @@ func main() {
 func storeFromCli(clictx *cli.Context) (fixity.Store, error) {
 	return fixity.NewFromPath("", clictx.GlobalString("config"))
 }
+
+// storeComponentNames returns the blobstore and index names from the cli
+// flags, defaulting to the names used by the configured store.
+func storeComponentNames(clictx *cli.Context, c config.Config) (string, string, error) {
+	bsName, ixName := clictx.String("blobstore"), clictx.String("index")
+	if bsName != "" && ixName != "" {
+		return bsName, ixName, nil
+	}
+
+	// the builtin stores share these config fields.
+	var sc struct {
+		BlobstoreName string `json:"blobstoreName"`
+		IndexName     string `json:"indexName"`
+	}
+	if err := c.StoreConfig(c.Store, &sc); err != nil {
+		return "", "", fmt.Errorf("store config: %v", err)
+	}
+
+	if bsName == "" {
+		bsName = sc.BlobstoreName
+	}
+	if ixName == "" {
+		ixName = sc.IndexName
+	}
+
+	if bsName == "" || ixName == "" {
+		return "", "", errors.New("blobstore and index names required")
+	}
+
+	return bsName, ixName, nil
+}
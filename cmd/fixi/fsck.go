@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/fsck"
+	"github.com/leeola/fixity/config"
+	"github.com/leeola/fixity/index"
+	"github.com/urfave/cli"
+)
+
+func FsckCmd(clictx *cli.Context) error {
+	c, err := config.Open(clictx.GlobalString("config"))
+	if err != nil {
+		return fmt.Errorf("open config: %v", err)
+	}
+
+	bsName, ixName, err := storeComponentNames(clictx, c)
+	if err != nil {
+		// no wrap above helper errs
+		return err
+	}
+
+	bs, err := fixity.NewBlobstoreFromConfig(bsName, c)
+	if err != nil {
+		return fmt.Errorf("blobstoreFromConfig: %v", err)
+	}
+
+	fsckbs, ok := bs.(fsck.Blobstore)
+	if !ok {
+		return fmt.Errorf("blobstore %q does not support enumerating blobs", bsName)
+	}
+
+	var lister index.Lister
+	if !clictx.Bool("no-index") {
+		ix, err := fixity.NewIndexFromConfig(ixName, c)
+		if err != nil {
+			return fmt.Errorf("indexFromConfig: %v", err)
+		}
+
+		l, ok := ix.(index.Lister)
+		if !ok {
+			return fmt.Errorf("index %q does not support listing entries, use --no-index", ixName)
+		}
+		lister = l
+	}
+
+	report, err := fsck.Check(context.Background(), fsckbs, lister)
+	if err != nil {
+		return fmt.Errorf("check: %v", err)
+	}
+
+	for _, p := range report.Problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+
+	fmt.Printf("checked %d blobs, %d data streams, %d index entries\n",
+		report.Blobs, report.Data, report.Index)
+
+	if report.Damaged() {
+		return fmt.Errorf("store damaged: %d problems found", len(report.Problems))
+	}
+
+	return nil
+}
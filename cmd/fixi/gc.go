@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/gc"
+	"github.com/leeola/fixity/config"
+	"github.com/urfave/cli"
+)
+
+func GCCmd(clictx *cli.Context) error {
+	c, err := config.Open(clictx.GlobalString("config"))
+	if err != nil {
+		return fmt.Errorf("open config: %v", err)
+	}
+
+	bsName, ixName, err := storeComponentNames(clictx, c)
+	if err != nil {
+		// no wrap above helper errs
+		return err
+	}
+
+	bs, err := fixity.NewBlobstoreFromConfig(bsName, c)
+	if err != nil {
+		return fmt.Errorf("blobstoreFromConfig: %v", err)
+	}
+
+	gcbs, ok := bs.(gc.Blobstore)
+	if !ok {
+		return fmt.Errorf("blobstore %q does not support garbage collection", bsName)
+	}
+
+	ix, err := fixity.NewIndexFromConfig(ixName, c)
+	if err != nil {
+		return fmt.Errorf("indexFromConfig: %v", err)
+	}
+
+	dryRun := clictx.Bool("dry-run")
+
+	report, err := gc.Collect(context.Background(), gcbs, ix, gc.Config{
+		DryRun:      dryRun,
+		GracePeriod: clictx.Duration("grace"),
+		Force:       clictx.Bool("force"),
+	})
+	if err == gc.ErrNoIndexedMutations {
+		return fmt.Errorf("collect: %v, use --force to delete every blob", err)
+	}
+	if err != nil {
+		return fmt.Errorf("collect: %v", err)
+	}
+
+	for _, ref := range report.Unreadable {
+		fmt.Printf("unreadable blob: %s\n", ref)
+	}
+
+	if clictx.Bool("verbose") || dryRun {
+		for _, ref := range report.Swept {
+			fmt.Println(ref)
+		}
+	}
+
+	sweptMsg := "swept"
+	if dryRun {
+		sweptMsg = "would sweep"
+	}
+
+	fmt.Printf("marked %d blobs, %s %d blobs (%d bytes), skipped %d young blobs\n",
+		report.Marked, sweptMsg, len(report.Swept), report.SweptSize, report.Young)
+
+	return nil
+}
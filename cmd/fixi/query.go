@@ -6,6 +6,7 @@ import (
 	"strings"
 	"text/tabwriter"
 
+	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/q"
 	"github.com/urfave/cli"
 )
@@ -19,15 +20,70 @@ func QueryCmd(clictx *cli.Context) error {
 
 	qStr := strings.Join(clictx.Args(), " ")
 
-	matches, err := s.Query(q.FromString(qStr))
+	qu, err := q.FromString(qStr)
 	if err != nil {
-		return fmt.Errorf("query: %v", err)
+		return fmt.Errorf("query %q: %v", qStr, err)
+	}
+
+	qu = qu.WithLimit(clictx.Int("limit")).
+		WithOffset(clictx.Int("offset")).
+		WithAfter(clictx.String("after"))
+	all := clictx.Bool("all")
+
+	if sort := clictx.String("sort"); sort != "" {
+		keys, err := q.ParseSort(sort)
+		if err != nil {
+			return fmt.Errorf("parsesort: %v", err)
+		}
+		qu = qu.WithSort(keys...)
+	}
+
+	var fields []string
+	if f := clictx.String("fields"); f != "" {
+		for _, field := range strings.Split(f, ",") {
+			fields = append(fields, strings.TrimSpace(field))
+		}
+		qu = qu.WithFields(fields...)
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
-	fmt.Fprintf(w, "\tREF\tID\t\n")
-	for i, m := range matches {
-		fmt.Fprintf(w, "%d\t%s\t%s\t\n", i+1, m.Ref, m.ID)
+	fmt.Fprintf(w, "\tREF\tID\t")
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s\t", strings.ToUpper(f))
+	}
+	fmt.Fprintln(w)
+
+	var i int
+	for {
+		page, err := fixity.QueryPage(s, qu)
+		if err != nil {
+			return fmt.Errorf("query: %v", err)
+		}
+
+		for _, m := range page.Matches {
+			i++
+			fmt.Fprintf(w, "%d\t%s\t%s\t", i, m.Ref, m.ID)
+			for _, f := range fields {
+				// missing fields are left empty.
+				v, _ := m.Values[f].ToString()
+				fmt.Fprintf(w, "%s\t", v)
+			}
+			fmt.Fprintln(w)
+		}
+
+		if page.Next == "" {
+			break
+		}
+
+		if !all {
+			w.Flush()
+			fmt.Fprintf(os.Stderr, "more matches after: %s\n", page.Next)
+			return nil
+		}
+
+		// flush each page, to print large results as they are queried.
+		w.Flush()
+		qu = qu.WithOffset(0).WithAfter(page.Next)
 	}
 	w.Flush()
 
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leeola/fixity/index/reindex"
+	"github.com/urfave/cli"
+)
+
+// reindexer is implemented by the builtin stores, which rebuild their
+// index from the mutations they verify.
+type reindexer interface {
+	Reindex(context.Context) (reindex.Report, error)
+}
+
+func ReindexCmd(clictx *cli.Context) error {
+	s, err := storeFromCli(clictx)
+	if err != nil {
+		// no wrap above helper errs
+		return err
+	}
+
+	r, ok := s.(reindexer)
+	if !ok {
+		return fmt.Errorf("store does not support reindexing")
+	}
+
+	report, err := r.Reindex(context.Background())
+	if err != nil {
+		return fmt.Errorf("reindex: %v", err)
+	}
+
+	for _, ref := range report.Unverified {
+		fmt.Printf("unverified mutation: %s\n", ref)
+	}
+
+	fmt.Printf("reindexed %d mutations, skipped %d unverified mutations\n",
+		report.Indexed, len(report.Unverified))
+
+	return nil
+}
@@ -98,7 +98,21 @@ func writeReadCloser(clictx *cli.Context, s store, r io.Reader, id string) error
 		values[k] = value.String(v)
 	}
 
-	hashes, err := s.Write(context.Background(), id, values, r)
+	opts := fixity.WriteOptions{
+		AverageChunkSize: clictx.Int("avg-chunk-size"),
+	}
+
+	var (
+		hashes []fixity.Ref
+		err    error
+	)
+	if ow, ok := s.(fixity.OptionsWriter); ok {
+		hashes, err = ow.WriteWithOptions(context.Background(), id, values, r, opts)
+	} else if opts == (fixity.WriteOptions{}) {
+		hashes, err = s.Write(context.Background(), id, values, r)
+	} else {
+		return errors.New("store does not support write options")
+	}
 	if err != nil {
 		return fmt.Errorf("write: %v", err)
 	}
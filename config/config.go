@@ -33,6 +33,30 @@ type TypeConfig struct {
 	Type            string          `json:"type"`
 	Config          json.RawMessage `json:"config"`
 	ConfigInterface interface{}     `json:"-"`
+
+	// VerifyReads hashes blobs as they are read, failing reads of blobs
+	// which do not match their ref.
+	//
+	// Only used by blobstores.
+	VerifyReads bool `json:"verifyReads,omitempty"`
+
+	// Chunker configures the chunking of written data, defaulting to the
+	// default chunker if nil.
+	//
+	// Only used by stores.
+	Chunker *ChunkerConfig `json:"chunker,omitempty"`
+}
+
+type ChunkerConfig struct {
+	// Type is the registered chunker type, such as resticfork or fastcdc.
+	Type string `json:"type,omitempty"`
+
+	// AverageSize is the average chunk size in bytes, defaulting to the
+	// default of the chunker type if zero.
+	AverageSize int `json:"averageSize,omitempty"`
+
+	// Config is the optional chunker type specific config.
+	Config json.RawMessage `json:"config,omitempty"`
 }
 
 func (c Config) BlobstoreConfig(key string, v interface{}) error {
@@ -17,7 +17,12 @@ type Mutation struct {
 	Time         time.Time `json:"time"`
 	ValuesSchema Ref       `json:"valuesSchema,omitempty"`
 	DataSchema   Ref       `json:"dataSchema,omitempty"`
-	Signature    string    `json:"signature"`
+
+	// Previous is the ref of the mutation of the same ID that this
+	// mutation replaced, if any.
+	Previous Ref `json:"previous,omitempty"`
+
+	Signature string `json:"signature"`
 }
 
 func New() (Store, error) {
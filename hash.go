@@ -44,6 +44,17 @@ func Hash(b []byte) (Ref, error) {
 	return NewRef(mh), nil
 }
 
+// HashRef returns the Ref of a digest summed by the Hasher of the
+// DefaultMultihashName, allowing Refs of incrementally hashed bytes.
+func HashRef(digest []byte) (Ref, error) {
+	mh, err := multihash.Encode(digest, multihashCode)
+	if err != nil {
+		return "", fmt.Errorf("encode: %v", err)
+	}
+
+	return NewRef(mh), nil
+}
+
 // Hasher returns a *non-multihash* hash.Hash interface allowing incremental
 // writes to generate a sum.
 func Hasher(multihashName string) (hash.Hash, error) {
@@ -1,6 +1,7 @@
 package fixity
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/leeola/fixity/config"
@@ -22,9 +23,71 @@ type Querier interface {
 	Query(q.Query) ([]Match, error)
 }
 
+// PageQuerier is an optional Querier interface, returning the cursor of
+// the matches following the queried page.
+type PageQuerier interface {
+	QueryPage(q.Query) (Page, error)
+}
+
 type Match struct {
 	ID  string `json:"id"`
 	Ref Ref    `json:"ref"`
+
+	// Values are the fields requested by q.Query.Fields, both value fields
+	// and index keys such as fsize and fnamespace. The ftime index key is
+	// an RFC 3339 string. Fields without a value are omitted.
+	Values Values `json:"values,omitempty"`
+}
+
+// Page is the matches of a query, limited by the LimitBy of the query.
+type Page struct {
+	Matches []Match `json:"matches"`
+
+	// Next is the cursor of the following page, to be queried as
+	// q.Query.After. Next is empty if there are no further matches.
+	//
+	// Cursors are index specific. A cursor may be the offset of the
+	// following match, as with the bleve index, in which case matches
+	// indexed or replaced between pages shift the following pages, and
+	// are skipped or returned twice. Cursors of the sqlite index record
+	// the last match, and are not affected.
+	Next string `json:"next,omitempty"`
+}
+
+// QueryPage queries a page of matches, with the Querier if it implements
+// PageQuerier.
+//
+// Otherwise the Offset of the query is applied to the matches of Query,
+// and no Next cursor is returned. Queries with an After cursor then return
+// an error.
+func QueryPage(qr Querier, qu q.Query) (Page, error) {
+	if pq, ok := qr.(PageQuerier); ok {
+		return pq.QueryPage(qu)
+	}
+
+	if qu.After != "" {
+		return Page{}, errors.New("querier does not support cursors")
+	}
+	if qu.Offset < 0 {
+		return Page{}, fmt.Errorf("negative offset: %d", qu.Offset)
+	}
+
+	offset := qu.Offset
+	qu.Offset = 0
+	if qu.LimitBy > 0 {
+		qu.LimitBy += offset
+	}
+
+	matches, err := qr.Query(qu)
+	if err != nil {
+		return Page{}, err // no wrap helper err
+	}
+
+	if offset >= len(matches) {
+		return Page{}, nil
+	}
+
+	return Page{Matches: matches[offset:]}, nil
 }
 
 func NewIndexFromConfig(name string, c config.Config) (Index, error) {
@@ -2,28 +2,54 @@ package bleve
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/leeola/fixity/config"
+	"github.com/leeola/fixity/index"
 	"github.com/leeola/fixity/util/pathutil"
 )
 
 const (
 	idIndexDir  = "id"
 	refIndexDir = "ref"
+
+	// currentFile contains the dir of the current indexes, relative to the
+	// root path, as written by Reset. The indexes are in the root path if
+	// it does not exist.
+	currentFile = "current"
+
+	// resetDirPrefix is the prefix of the dirs of indexes created by Reset.
+	resetDirPrefix = "reset-"
 )
 
 type Config struct {
 	Path string `json:"path"`
 }
 
+// mappingVersion is the version of newMapping, stored in each index. It
+// must be incremented whenever the mapping changes, as bleve only applies
+// a mapping when creating an index.
+const mappingVersion = 1
+
+var mappingVersionKey = []byte("fixity.mappingVersion")
+
 type Index struct {
 	idIndex  bleve.Index
 	refIndex bleve.Index
+	rootPath string
+	// dir is the dir of the indexes, relative to the root path.
+	dir string
+
+	// stale is the error of an index created with an older mapping,
+	// returned by Index and Query until the index is Reset.
+	stale error
 }
 
 func New(name string, cfg config.Config) (*Index, error) {
@@ -41,23 +67,144 @@ func New(name string, cfg config.Config) (*Index, error) {
 		return nil, fmt.Errorf("rootpath and bleve path empty")
 	}
 
-	idPath := filepath.Join(rootPath, idIndexDir)
-	refPath := filepath.Join(rootPath, refIndexDir)
+	return open(rootPath)
+}
+
+func open(rootPath string) (*Index, error) {
+	b, err := ioutil.ReadFile(filepath.Join(rootPath, currentFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("readfile: %v", err)
+	}
+
+	return openDir(rootPath, string(b))
+}
+
+// openDir opens or creates the indexes in the dir of the root path.
+func openDir(rootPath, dir string) (*Index, error) {
+	ix := &Index{rootPath: rootPath, dir: dir}
 
-	idIndex, err := newBleve(idPath)
+	var err error
+	ix.idIndex, err = newBleve(filepath.Join(rootPath, dir, idIndexDir))
 	if err != nil {
 		return nil, fmt.Errorf("newBleve: %v", err)
 	}
 
-	refIndex, err := newBleve(refPath)
+	ix.refIndex, err = newBleve(filepath.Join(rootPath, dir, refIndexDir))
 	if err != nil {
+		ix.idIndex.Close()
 		return nil, fmt.Errorf("newBleve: %v", err)
 	}
 
-	return &Index{
-		idIndex:  idIndex,
-		refIndex: refIndex,
-	}, nil
+	for _, bix := range []bleve.Index{ix.idIndex, ix.refIndex} {
+		b, err := bix.GetInternal(mappingVersionKey)
+		if err != nil {
+			ix.Close()
+			return nil, fmt.Errorf("getinternal: %v", err)
+		}
+
+		// indexes created before the version was stored have none.
+		v, _ := strconv.Atoi(string(b))
+		if v < mappingVersion {
+			ix.stale = fmt.Errorf("bleve index %s has mapping version %d, want %d: run fixi reindex",
+				rootPath, v, mappingVersion)
+		}
+	}
+
+	return ix, nil
+}
+
+// Close closes both indexes.
+func (ix *Index) Close() error {
+	idErr := ix.idIndex.Close()
+	if err := ix.refIndex.Close(); err != nil {
+		return fmt.Errorf("close ref index: %v", err)
+	}
+	if idErr != nil {
+		return fmt.Errorf("close id index: %v", idErr)
+	}
+	return nil
+}
+
+// Reset implements index.Resetter, replacing the indexes with empty
+// indexes of the current mapping.
+//
+// The empty indexes are created in a new dir and opened before the current
+// indexes are closed, so that an error leaves the current indexes in use.
+func (ix *Index) Reset() error {
+	// remove the indexes of a previous Reset which failed.
+	leftovers, err := filepath.Glob(filepath.Join(ix.rootPath, resetDirPrefix+"*"))
+	if err != nil {
+		return fmt.Errorf("glob: %v", err)
+	}
+	for _, p := range leftovers {
+		if filepath.Base(p) == ix.dir {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("removeall: %v", err)
+		}
+	}
+
+	dir := resetDirPrefix + strconv.FormatInt(time.Now().UnixNano(), 10)
+	reset, err := openDir(ix.rootPath, dir)
+	if err != nil {
+		os.RemoveAll(filepath.Join(ix.rootPath, dir))
+		return err // no wrap helper err
+	}
+
+	if err := writeCurrent(ix.rootPath, dir); err != nil {
+		reset.Close()
+		os.RemoveAll(filepath.Join(ix.rootPath, dir))
+		return fmt.Errorf("writecurrent: %v", err)
+	}
+
+	old := *ix
+	*ix = *reset
+
+	if err := old.Close(); err != nil {
+		return err // no wrap helper err
+	}
+
+	// indexes in the root path are not in a dir of their own.
+	oldPaths := []string{filepath.Join(old.rootPath, old.dir)}
+	if old.dir == "" {
+		oldPaths = []string{
+			filepath.Join(old.rootPath, idIndexDir),
+			filepath.Join(old.rootPath, refIndexDir),
+		}
+	}
+	for _, p := range oldPaths {
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("removeall: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeCurrent atomically replaces the current file with the dir.
+func writeCurrent(rootPath, dir string) error {
+	f, err := ioutil.TempFile(rootPath, "."+currentFile+".tmp")
+	if err != nil {
+		return fmt.Errorf("tempfile: %v", err)
+	}
+
+	if _, err := f.WriteString(dir); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("close: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(rootPath, currentFile)); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("rename: %v", err)
+	}
+
+	return nil
 }
 
 func newBleve(path string) (bleve.Index, error) {
@@ -71,6 +218,10 @@ func newBleve(path string) (bleve.Index, error) {
 		if err != nil {
 			return nil, fmt.Errorf("new ref index: %v", err)
 		}
+		v := []byte(strconv.Itoa(mappingVersion))
+		if err := index.SetInternal(mappingVersionKey, v); err != nil {
+			return nil, fmt.Errorf("setinternal: %v", err)
+		}
 		return index, nil
 	}
 	if err != nil {
@@ -92,6 +243,14 @@ func newMapping() *mapping.IndexMappingImpl {
 	// ref: https://github.com/blevesearch/bleve/issues/844
 	indexMapping.DefaultMapping.AddFieldMappingsAt(fieldNameID, keywordFieldMapping)
 	indexMapping.DefaultMapping.AddFieldMappingsAt(fieldNameRef, keywordFieldMapping)
+	indexMapping.DefaultMapping.AddFieldMappingsAt(index.FNamespaceKey, keywordFieldMapping)
+
+	// string values are analyzed for full text search, splitting them into
+	// terms which cannot be ranged over or sorted by. The values are also
+	// indexed whole under the keyword field for ranges and sorting.
+	keywordDocMapping := bleve.NewDocumentMapping()
+	keywordDocMapping.DefaultAnalyzer = keyword.Name
+	indexMapping.DefaultMapping.AddSubDocumentMapping(fieldNameKeyword, keywordDocMapping)
 
 	return indexMapping
 }
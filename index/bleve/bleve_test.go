@@ -0,0 +1,94 @@
+package bleve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/value"
+)
+
+func TestMappingVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-bleve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	query := q.New().Eq(index.FIDKey, value.String("foo"))
+	write := func(ix *Index) error {
+		return ix.Index("ref1", fixity.Mutation{ID: "foo", Time: time.Now()}, nil,
+			fixity.Values{"name": value.String("a")})
+	}
+
+	ix, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(ix); err != nil {
+		t.Fatal(err)
+	}
+
+	// an index created with an older mapping.
+	if err := ix.idIndex.SetInternal(mappingVersionKey, []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err = open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.Query(query); err == nil || !strings.Contains(err.Error(), "run fixi reindex") {
+		t.Errorf("want reindex query err, got:%v", err)
+	}
+	if err := write(ix); err == nil {
+		t.Error("want write err for an older mapping")
+	}
+
+	if err := ix.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if matches, err := ix.Query(query); err != nil || len(matches) != 0 {
+		t.Fatalf("want no matches after reset, got:%v, err:%v", matches, err)
+	}
+	if err := write(ix); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale indexes were replaced.
+	if _, err := os.Stat(filepath.Join(dir, idIndexDir)); !os.IsNotExist(err) {
+		t.Errorf("want stale index removed, got:%v", err)
+	}
+
+	ix, err = open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches, err := ix.Query(query); err != nil || len(matches) != 1 {
+		t.Errorf("want 1 match after reopen, got:%v, err:%v", matches, err)
+	}
+
+	// a second reset replaces the indexes of the first.
+	resetDir := ix.dir
+	if err := ix.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, resetDir)); !os.IsNotExist(err) {
+		t.Errorf("want previous reset index removed, got:%v", err)
+	}
+	if matches, err := ix.Query(query); err != nil || len(matches) != 0 {
+		t.Errorf("want no matches after second reset, got:%v, err:%v", matches, err)
+	}
+}
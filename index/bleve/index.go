@@ -9,8 +9,12 @@ import (
 )
 
 func (ix *Index) Index(ref fixity.Ref, m fixity.Mutation, d *fixity.DataSchema, v fixity.Values) error {
+	if ix.stale != nil {
+		return ix.stale
+	}
 
 	indexedValues := map[string]interface{}{}
+	keywordValues := map[string]interface{}{}
 
 	if v != nil {
 		for k, v := range v {
@@ -22,11 +26,16 @@ func (ix *Index) Index(ref fixity.Ref, m fixity.Mutation, d *fixity.DataSchema,
 			default:
 				return fmt.Errorf("unhandled value type: %s", v.Type)
 			}
+			keywordValues[k] = indexedValues[k]
 		}
 	}
 
+	indexedValues[fieldNameKeyword] = keywordValues
+
 	indexedValues[index.FIDKey] = m.ID
 	indexedValues[index.FRefKey] = string(ref)
+	indexedValues[index.FTimeKey] = m.Time
+	indexedValues[index.FNamespaceKey] = m.Namespace
 	if d != nil {
 		indexedValues[index.FSizeKey] = d.Size
 		indexedValues[index.FChecksumKey] = d.Checksum
@@ -0,0 +1,55 @@
+package bleve
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve"
+	"github.com/leeola/fixity"
+)
+
+// listPageSize is the number of hits fetched per search while listing, or
+// while querying without a limit.
+const listPageSize = 100
+
+// List implements index.Lister, listing the entries of both the ref and
+// id indexes.
+func (ix *Index) List(fn func(fixity.Match) error) error {
+	if err := listIndex(ix.refIndex, fn); err != nil {
+		return fmt.Errorf("ref index: %v", err)
+	}
+
+	if err := listIndex(ix.idIndex, fn); err != nil {
+		return fmt.Errorf("id index: %v", err)
+	}
+
+	return nil
+}
+
+func listIndex(ix bleve.Index, fn func(fixity.Match) error) error {
+	for from := 0; ; from += listPageSize {
+		search := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), listPageSize, from, false)
+		search.Fields = []string{fieldNameID, fieldNameRef}
+		// sort by document id for stable paging.
+		search.SortBy([]string{"_id"})
+
+		searchResults, err := ix.Search(search)
+		if err != nil {
+			return fmt.Errorf("search: %v", err)
+		}
+
+		for _, hit := range searchResults.Hits {
+			m, err := hitMatch(hit)
+			if err != nil {
+				return fmt.Errorf("hit %q: %v", hit.ID, err)
+			}
+
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+
+		if len(searchResults.Hits) < listPageSize {
+			return nil
+		}
+	}
+}
@@ -2,21 +2,67 @@ package bleve
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
 	"github.com/blevesearch/bleve/search/query"
 	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/index"
 	"github.com/leeola/fixity/q"
 	"github.com/leeola/fixity/q/operator"
+	"github.com/leeola/fixity/value"
 )
 
 const (
 	fieldNameRef = index.FRefKey
 	fieldNameID  = index.FIDKey
+
+	// fieldNameKeyword is the sub-document of the unanalyzed values.
+	fieldNameKeyword = "fkeyword"
 )
 
+// indexKeys are the fields indexed from the mutation rather than from its
+// values, none of which are split into terms.
+var indexKeys = map[string]bool{
+	index.FIDKey:        true,
+	index.FRefKey:       true,
+	index.FSizeKey:      true,
+	index.FChecksumKey:  true,
+	index.FTimeKey:      true,
+	index.FNamespaceKey: true,
+}
+
+// keywordField returns the field of the unanalyzed value of the field.
+func keywordField(field string) string {
+	if indexKeys[field] {
+		return field
+	}
+	return fieldNameKeyword + "." + field
+}
+
 func (ix *Index) Query(qu q.Query) ([]fixity.Match, error) {
+	page, err := ix.QueryPage(qu)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	return page.Matches, nil
+}
+
+// QueryPage implements fixity.PageQuerier. Cursors are the offsets of the
+// following matches, ordered by the sort keys of the query or by score,
+// and then by id.
+//
+// The bleve search request cannot start after the sort values of a hit,
+// so writes between pages shift the offsets of the following matches,
+// which are then skipped or returned twice. See fixity.Page.
+func (ix *Index) QueryPage(qu q.Query) (fixity.Page, error) {
+	if ix.stale != nil {
+		return fixity.Page{}, ix.stale
+	}
+
 	var index bleve.Index
 	if qu.IncludeVersions {
 		index = ix.refIndex
@@ -27,50 +73,144 @@ func (ix *Index) Query(qu q.Query) ([]fixity.Match, error) {
 	return queryIndex(index, qu)
 }
 
-func queryIndex(ix bleve.Index, qu q.Query) ([]fixity.Match, error) {
+func queryIndex(ix bleve.Index, qu q.Query) (fixity.Page, error) {
 	bq, err := fixQtoBleveQ(qu.Constraint)
 	if err != nil {
-		return nil, err // avoiding helper context to callers
+		return fixity.Page{}, err // avoiding helper context to callers
 	}
 
-	search := bleve.NewSearchRequest(bq)
-	search.Fields = []string{fieldNameID, fieldNameRef}
-
-	searchResults, err := ix.Search(search)
+	from, err := cursorOffset(qu)
 	if err != nil {
-		return nil, fmt.Errorf("search: %v", err)
+		return fixity.Page{}, err // avoiding helper context to callers
 	}
 
-	matches := make([]fixity.Match, len(searchResults.Hits))
+	var page fixity.Page
+	for {
+		// without a limit, every match is searched a page at a time.
+		size := listPageSize
+		if qu.LimitBy > 0 {
+			size = qu.LimitBy - len(page.Matches)
+		}
+
+		search := bleve.NewSearchRequestOptions(bq, size, from, false)
+		search.Fields = append([]string{fieldNameID, fieldNameRef}, qu.Fields...)
+		search.SortByCustom(sortOrder(qu.SortBy))
 
-	for i, hit := range searchResults.Hits {
-		refIfc, ok := hit.Fields[fieldNameRef]
-		if !ok {
-			return nil, fmt.Errorf("hit does not contain field: %s", fieldNameRef)
+		searchResults, err := ix.Search(search)
+		if err != nil {
+			return fixity.Page{}, fmt.Errorf("search: %v", err)
 		}
 
-		refStr, ok := refIfc.(string)
-		if !ok {
-			return nil, fmt.Errorf("hit field ref not valid string")
+		for _, hit := range searchResults.Hits {
+			m, err := hitMatch(hit)
+			if err != nil {
+				return fixity.Page{}, err // avoiding helper context to callers
+			}
+			m.Values = hitValues(hit, qu.Fields)
+			page.Matches = append(page.Matches, m)
 		}
+		from += len(searchResults.Hits)
 
-		idIfc, ok := hit.Fields[fieldNameID]
-		if !ok {
-			return nil, fmt.Errorf("hit does not contain field: %s", fieldNameRef)
+		if len(searchResults.Hits) == 0 || uint64(from) >= searchResults.Total {
+			return page, nil
 		}
 
-		id, ok := idIfc.(string)
-		if !ok {
-			return nil, fmt.Errorf("hit field ref not valid string")
+		if qu.LimitBy > 0 && len(page.Matches) >= qu.LimitBy {
+			page.Next = strconv.Itoa(from)
+			return page, nil
 		}
+	}
+}
+
+// sortOrder returns the bleve sort order of the sort keys, sorting by
+// score without keys. Value fields are sorted by their keyword field, as
+// bleve sorts analyzed fields by a single term. Ties are broken by
+// document id, for stable paging.
+func sortOrder(keys []q.SortKey) search.SortOrder {
+	if len(keys) == 0 {
+		return search.SortOrder{&search.SortScore{Desc: true}, &search.SortDocID{}}
+	}
+
+	order := make(search.SortOrder, 0, len(keys)+1)
+	for _, k := range keys {
+		order = append(order, &search.SortField{
+			Field:   keywordField(k.Field),
+			Desc:    k.Descending,
+			Missing: search.SortFieldMissingLast,
+		})
+	}
+
+	return append(order, &search.SortDocID{})
+}
+
+// cursorOffset returns the offset of the first match of the query, from
+// its After cursor and Offset.
+func cursorOffset(qu q.Query) (int, error) {
+	if qu.Offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", qu.Offset)
+	}
+
+	if qu.After == "" {
+		return qu.Offset, nil
+	}
+
+	after, err := strconv.Atoi(qu.After)
+	if err != nil || after < 0 {
+		return 0, fmt.Errorf("invalid cursor: %q", qu.After)
+	}
+
+	return after + qu.Offset, nil
+}
+
+// hitMatch returns the Match of a hit searched with the id and ref fields.
+func hitMatch(hit *search.DocumentMatch) (fixity.Match, error) {
+	refIfc, ok := hit.Fields[fieldNameRef]
+	if !ok {
+		return fixity.Match{}, fmt.Errorf("hit does not contain field: %s", fieldNameRef)
+	}
+
+	refStr, ok := refIfc.(string)
+	if !ok {
+		return fixity.Match{}, fmt.Errorf("hit field ref not valid string")
+	}
+
+	idIfc, ok := hit.Fields[fieldNameID]
+	if !ok {
+		return fixity.Match{}, fmt.Errorf("hit does not contain field: %s", fieldNameRef)
+	}
+
+	id, ok := idIfc.(string)
+	if !ok {
+		return fixity.Match{}, fmt.Errorf("hit field ref not valid string")
+	}
+
+	return fixity.Match{
+		ID:  id,
+		Ref: fixity.Ref(refStr),
+	}, nil
+}
+
+// hitValues returns the stored fields of the hit as values.
+//
+// Bleve returns numeric fields as float64, which are assumed to be ints as
+// the index only stores int numbers, and datetime fields as RFC 3339
+// strings. Fields of other types, such as repeated fields, are omitted.
+func hitValues(hit *search.DocumentMatch, fields []string) fixity.Values {
+	if len(fields) == 0 {
+		return nil
+	}
 
-		matches[i] = fixity.Match{
-			ID:  id,
-			Ref: fixity.Ref(refStr),
+	values := fixity.Values{}
+	for _, f := range fields {
+		switch v := hit.Fields[f].(type) {
+		case float64:
+			values[f] = value.Int(int(v))
+		case string:
+			values[f] = value.String(v)
 		}
 	}
 
-	return matches, nil
+	return values
 }
 
 func fixQtoBleveQ(c q.Constraint) (query.Query, error) {
@@ -89,7 +229,122 @@ func fixQtoBleveQ(c q.Constraint) (query.Query, error) {
 			bq.FieldVal = *c.Field
 		}
 		return bq, nil
+	case operator.Gt, operator.Gte, operator.Lt, operator.Lte, operator.Between:
+		return rangeQuery(c)
+	case operator.And, operator.Or:
+		if len(c.SubConstraints) == 0 {
+			return nil, fmt.Errorf("%s op missing subconstraints", c.Operator)
+		}
+		bqs := make([]query.Query, len(c.SubConstraints))
+		for i, sc := range c.SubConstraints {
+			bq, err := fixQtoBleveQ(sc)
+			if err != nil {
+				return nil, err // no wrap recursive err
+			}
+			bqs[i] = bq
+		}
+		if c.Operator == operator.And {
+			return bleve.NewConjunctionQuery(bqs...), nil
+		}
+		return bleve.NewDisjunctionQuery(bqs...), nil
+	case operator.Not:
+		if len(c.SubConstraints) != 1 {
+			return nil, fmt.Errorf("not op requires one subconstraint, got %d", len(c.SubConstraints))
+		}
+		sub, err := fixQtoBleveQ(c.SubConstraints[0])
+		if err != nil {
+			return nil, err // no wrap recursive err
+		}
+		// bleve only excludes from other matches, so match everything else.
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(bleve.NewMatchAllQuery())
+		bq.AddMustNot(sub)
+		return bq, nil
 	default:
 		return nil, fmt.Errorf("unsupported constraint operator: %q", c.Operator)
 	}
 }
+
+// rangeQuery translates a range constraint into a date range query for
+// ftime, a numeric range query for int values, or a term range query of
+// the keyword field for string values.
+func rangeQuery(c q.Constraint) (query.Query, error) {
+	lower, upper, err := q.RangeBounds(c)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	if *c.Field == index.FTimeKey {
+		return dateRangeQuery(lower, upper)
+	}
+
+	// RangeBounds ensures that Between bounds share a type.
+	var typ value.Type
+	if lower != nil {
+		typ = lower.Value.Type
+	} else {
+		typ = upper.Value.Type
+	}
+
+	switch typ {
+	case value.TypeInt:
+		var (
+			min, max       *float64
+			minInc, maxInc bool
+		)
+		if lower != nil {
+			f := float64(lower.Value.IntValue)
+			min, minInc = &f, lower.Inclusive
+		}
+		if upper != nil {
+			f := float64(upper.Value.IntValue)
+			max, maxInc = &f, upper.Inclusive
+		}
+		bq := bleve.NewNumericRangeInclusiveQuery(min, max, &minInc, &maxInc)
+		bq.FieldVal = *c.Field
+		return bq, nil
+
+	default:
+		// an empty term is unbounded.
+		var (
+			min, max       string
+			minInc, maxInc bool
+		)
+		if lower != nil {
+			min, minInc = lower.Value.StringValue, lower.Inclusive
+		}
+		if upper != nil {
+			max, maxInc = upper.Value.StringValue, upper.Inclusive
+		}
+		bq := bleve.NewTermRangeInclusiveQuery(min, max, &minInc, &maxInc)
+		bq.FieldVal = keywordField(*c.Field)
+		return bq, nil
+	}
+}
+
+// dateRangeQuery returns the ftime range query of the bounds, a zero
+// time being unbounded.
+func dateRangeQuery(lower, upper *q.Bound) (query.Query, error) {
+	var (
+		start, end       time.Time
+		startInc, endInc bool
+	)
+	if lower != nil {
+		t, err := index.ParseTime(lower.Value)
+		if err != nil {
+			return nil, err // no wrap helper err
+		}
+		start, startInc = t, lower.Inclusive
+	}
+	if upper != nil {
+		t, err := index.ParseTime(upper.Value)
+		if err != nil {
+			return nil, err // no wrap helper err
+		}
+		end, endInc = t, upper.Inclusive
+	}
+
+	bq := bleve.NewDateRangeInclusiveQuery(start, end, &startInc, &endInc)
+	bq.FieldVal = index.FTimeKey
+	return bq, nil
+}
@@ -0,0 +1,237 @@
+package bleve
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/value"
+)
+
+func TestRangeQuery(t *testing.T) {
+	bq, err := fixQtoBleveQ(q.Gt(index.FSizeKey, value.Int(1<<30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nq, ok := bq.(*query.NumericRangeQuery)
+	if !ok {
+		t.Fatalf("want numeric range query, got:%T", bq)
+	}
+	if nq.FieldVal != index.FSizeKey || nq.Min == nil || *nq.Min != 1<<30 ||
+		*nq.InclusiveMin || nq.Max != nil {
+		t.Errorf("unexpected numeric range query: %+v", nq)
+	}
+
+	bq, err = fixQtoBleveQ(q.Between("date", value.String("2017-01-01"), value.String("2017-12-31")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq, ok := bq.(*query.TermRangeQuery)
+	if !ok {
+		t.Fatalf("want term range query, got:%T", bq)
+	}
+	if tq.FieldVal != keywordField("date") || tq.Min != "2017-01-01" || tq.Max != "2017-12-31" ||
+		!*tq.InclusiveMin || !*tq.InclusiveMax {
+		t.Errorf("unexpected term range query: %+v", tq)
+	}
+
+	if _, err := fixQtoBleveQ(q.Between("n", value.Int(1), value.String("2"))); err == nil {
+		t.Error("want error for between bounds of different types")
+	}
+}
+
+// newTestIndex returns an in memory index of three mutations, whose
+// sizes, times and names are each in a different order.
+func newTestIndex(t *testing.T) *Index {
+	idIndex, err := bleve.NewMemOnly(newMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refIndex, err := bleve.NewMemOnly(newMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := &Index{idIndex: idIndex, refIndex: refIndex}
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	writes := []struct {
+		Ref    fixity.Ref
+		Time   time.Time
+		Size   int64
+		Values fixity.Values
+	}{
+		{"ref1", t0.Add(time.Hour), 20,
+			fixity.Values{"name": value.String("zeta alpha"), "n": value.Int(1)}},
+		{"ref2", t0.Add(2 * time.Hour), 5,
+			fixity.Values{"name": value.String("beta"), "n": value.Int(2)}},
+		{"ref3", t0, 10,
+			fixity.Values{"name": value.String("gamma delta"), "n": value.Int(3)}},
+	}
+	for _, w := range writes {
+		m := fixity.Mutation{ID: "id" + string(w.Ref), Time: w.Time}
+		d := &fixity.DataSchema{Size: w.Size, Checksum: "c" + string(w.Ref)}
+		if err := ix.Index(w.Ref, m, d, w.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ix
+}
+
+func queryRefs(t *testing.T, ix *Index, qu q.Query) []fixity.Ref {
+	matches, err := ix.Query(qu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []fixity.Ref
+	for _, m := range matches {
+		refs = append(refs, m.Ref)
+	}
+	return refs
+}
+
+func TestQueryRanges(t *testing.T) {
+	ix := newTestIndex(t)
+
+	testCases := []struct {
+		Name  string
+		Query q.Query
+		Want  []fixity.Ref
+	}{
+		{"size gte", q.New().Gte(index.FSizeKey, value.Int(10)),
+			[]fixity.Ref{"ref1", "ref3"}},
+		{"int value between", q.New().Between("n", value.Int(2), value.Int(3)),
+			[]fixity.Ref{"ref2", "ref3"}},
+		// string values are compared whole, not by their terms.
+		{"string value gt", q.New().Gt("name", value.String("gamma")),
+			[]fixity.Ref{"ref1", "ref3"}},
+		{"string value between", q.New().Between("name",
+			value.String("zeta alpha"), value.String("zeta alpha")),
+			[]fixity.Ref{"ref1"}},
+		{"string value lt", q.New().Lt("name", value.String("gamma delta")),
+			[]fixity.Ref{"ref2"}},
+		{"time gt", q.New().Gt(index.FTimeKey, value.String("2017-01-01T00:00:00Z")),
+			[]fixity.Ref{"ref1", "ref2"}},
+		{"time between", q.New().Between(index.FTimeKey,
+			value.String("2017-01-01"), value.String("2017-01-01T01:00:00Z")),
+			[]fixity.Ref{"ref1", "ref3"}},
+		{"time lt", q.New().Lt(index.FTimeKey, value.String("2017-01-01T01:00:00Z")),
+			[]fixity.Ref{"ref3"}},
+	}
+	for _, tc := range testCases {
+		got := queryRefs(t, ix, tc.Query.WithVersions())
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s want:%v, got:%v", tc.Name, tc.Want, got)
+		}
+	}
+
+	if _, err := ix.Query(q.New().Gt(index.FTimeKey, value.Int(1))); err == nil {
+		t.Error("want error for an int time bound")
+	}
+}
+
+func TestQuerySort(t *testing.T) {
+	ix := newTestIndex(t)
+
+	testCases := []struct {
+		Name string
+		Key  string
+		Want []fixity.Ref
+	}{
+		{"size", index.FSizeKey, []fixity.Ref{"ref2", "ref3", "ref1"}},
+		{"time", index.FTimeKey, []fixity.Ref{"ref3", "ref1", "ref2"}},
+		// multi-word values are sorted whole, not by their lowest term.
+		{"multi-word value", "name", []fixity.Ref{"ref2", "ref3", "ref1"}},
+	}
+	for _, tc := range testCases {
+		all := q.New().WithVersions().Gte(index.FSizeKey, value.Int(0))
+
+		got := queryRefs(t, ix, all.WithSort(q.Asc(tc.Key)))
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s ascending want:%v, got:%v", tc.Name, tc.Want, got)
+		}
+
+		var desc []fixity.Ref
+		for i := len(tc.Want) - 1; i >= 0; i-- {
+			desc = append(desc, tc.Want[i])
+		}
+		got = queryRefs(t, ix, all.WithSort(q.Desc(tc.Key)))
+		if !reflect.DeepEqual(got, desc) {
+			t.Errorf("%s descending want:%v, got:%v", tc.Name, desc, got)
+		}
+	}
+}
+
+func TestBooleanQuery(t *testing.T) {
+	a, b := q.Eq("a", value.String("1")), q.Eq("b", value.String("2"))
+
+	bq, err := fixQtoBleveQ(q.Or(a, q.And(a, q.Not(b))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dq, ok := bq.(*query.DisjunctionQuery)
+	if !ok || len(dq.Disjuncts) != 2 {
+		t.Fatalf("want disjunction of 2, got:%+v", bq)
+	}
+	cq, ok := dq.Disjuncts[1].(*query.ConjunctionQuery)
+	if !ok || len(cq.Conjuncts) != 2 {
+		t.Fatalf("want conjunction of 2, got:%+v", dq.Disjuncts[1])
+	}
+	if _, ok := cq.Conjuncts[1].(*query.BooleanQuery); !ok {
+		t.Fatalf("want boolean query for not, got:%T", cq.Conjuncts[1])
+	}
+
+	if _, err := fixQtoBleveQ(q.Constraint{Operator: "and"}); err == nil {
+		t.Error("want error for and without subconstraints")
+	}
+}
+
+func TestSortOrder(t *testing.T) {
+	order := sortOrder([]q.SortKey{q.Desc(index.FSizeKey), q.Asc("name")})
+	if len(order) != 3 {
+		t.Fatalf("want 3 sorts, got:%d", len(order))
+	}
+
+	size, ok := order[0].(*search.SortField)
+	if !ok || size.Field != index.FSizeKey || !size.Desc {
+		t.Errorf("want descending fsize sort, got:%+v", order[0])
+	}
+	name, ok := order[1].(*search.SortField)
+	if !ok || name.Field != keywordField("name") || name.Desc {
+		t.Errorf("want ascending name sort, got:%+v", order[1])
+	}
+	if _, ok := order[2].(*search.SortDocID); !ok {
+		t.Errorf("want document id tie break, got:%T", order[2])
+	}
+}
+
+func TestHitValues(t *testing.T) {
+	hit := &search.DocumentMatch{Fields: map[string]interface{}{
+		"name":         "a",
+		index.FSizeKey: float64(1 << 30),
+		index.FTimeKey: "2017-01-01T00:00:00Z",
+		"tags":         []interface{}{"x", "y"},
+	}}
+
+	values := hitValues(hit, []string{"name", index.FSizeKey, index.FTimeKey, "tags", "missing"})
+	want := fixity.Values{
+		"name":         value.String("a"),
+		index.FSizeKey: value.Int(1 << 30),
+		index.FTimeKey: value.String("2017-01-01T00:00:00Z"),
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("want:%v, got:%v", want, values)
+	}
+
+	if values := hitValues(hit, nil); values != nil {
+		t.Errorf("want nil values without fields, got:%v", values)
+	}
+}
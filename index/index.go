@@ -1,8 +1,12 @@
 package index
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/value"
 )
 
 type QueryIndexer interface {
@@ -20,9 +24,45 @@ type Querier interface {
 	Query(q.Query) ([]fixity.Match, error)
 }
 
+// Lister is an optional Index interface to enumerate every index entry.
+type Lister interface {
+	// List calls fn with every entry of the index, including versions.
+	//
+	// Implementations with multiple underlying indexes may call fn with
+	// the same match more than once.
+	List(fn func(fixity.Match) error) error
+}
+
+// Resetter is an optional Index interface to remove every entry of the
+// index, such as before rebuilding it.
+type Resetter interface {
+	Reset() error
+}
+
 const (
-	FIDKey       string = "fid"
-	FRefKey      string = "fref"
-	FSizeKey     string = "fsize"
-	FChecksumKey string = "fchecksum"
+	FIDKey        string = "fid"
+	FRefKey       string = "fref"
+	FSizeKey      string = "fsize"
+	FChecksumKey  string = "fchecksum"
+	FTimeKey      string = "ftime"
+	FNamespaceKey string = "fnamespace"
 )
+
+// ParseTime returns the time of an FTimeKey range value, which is an
+// RFC 3339 time or a UTC date such as 2017-01-02.
+func ParseTime(v value.Value) (time.Time, error) {
+	if v.Type != value.TypeString {
+		return time.Time{}, fmt.Errorf("%s value must be a time string, got %s", FTimeKey, v.Type)
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, v.StringValue); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", v.StringValue)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s value %q is not an RFC 3339 time or date", FTimeKey, v.StringValue)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,156 @@
+// Package reindex rebuilds an Index from the mutations stored in a
+// Blobstore.
+package reindex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/index"
+)
+
+// ListReader is a BlobReader which can enumerate every stored blob.
+type ListReader interface {
+	fixity.BlobReader
+	fixity.BlobLister
+}
+
+// Verifier verifies mutations before they are indexed, such as the hook of
+// a store verifying mutation signatures.
+type Verifier interface {
+	Verify(ctx context.Context, m fixity.Mutation) error
+}
+
+type Report struct {
+	// Indexed is the number of indexed mutations.
+	Indexed int
+
+	// Unverified are the mutations which failed verification, and were
+	// not indexed.
+	Unverified []fixity.Ref
+}
+
+type mutationRef struct {
+	Ref      fixity.Ref
+	Mutation fixity.Mutation
+}
+
+// Reindex indexes every mutation in the blobstore which is verified by v,
+// or every mutation if v is nil.
+//
+// Mutations are indexed in time order, and after their previous mutation,
+// ensuring the latest mutation of each id is indexed last and is thus the
+// current version of the id. Each mutation is verified just before it is
+// indexed, so a verifier querying the index sees the mutations preceding
+// it, such as the signer records of a signed store.
+//
+// Indexes implementing index.Resetter are reset first, such as to apply a
+// newer bleve mapping.
+func Reindex(ctx context.Context, bs ListReader, ix index.Indexer, v Verifier) (Report, error) {
+	var mutations []mutationRef
+	err := bs.List(ctx, "", func(ref fixity.Ref) error {
+		m, ok, err := blobstore.ReadMutation(ctx, bs, ref)
+		if err != nil {
+			return fmt.Errorf("readmutation %q: %v", ref, err)
+		}
+		if ok {
+			mutations = append(mutations, mutationRef{Ref: ref, Mutation: m})
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("list: %v", err)
+	}
+
+	sort.SliceStable(mutations, func(i, j int) bool {
+		return mutations[i].Mutation.Time.Before(mutations[j].Mutation.Time)
+	})
+
+	if r, ok := ix.(index.Resetter); ok {
+		if err := r.Reset(); err != nil {
+			return Report{}, fmt.Errorf("reset: %v", err)
+		}
+	}
+
+	listed := make(map[fixity.Ref]bool, len(mutations))
+	for _, mr := range mutations {
+		listed[mr.Ref] = true
+	}
+
+	var (
+		report Report
+		done   = map[fixity.Ref]bool{}
+		// waiting are the mutations of each previous mutation not yet
+		// indexed, such as mutations of an equal or skewed time.
+		waiting = map[fixity.Ref][]mutationRef{}
+	)
+
+	var indexRef func(mr mutationRef) error
+	indexRef = func(mr mutationRef) error {
+		done[mr.Ref] = true
+
+		if err := verify(ctx, v, mr.Mutation); err != nil {
+			report.Unverified = append(report.Unverified, mr.Ref)
+		} else {
+			if err := indexMutation(ctx, bs, ix, mr.Ref, mr.Mutation); err != nil {
+				return fmt.Errorf("index %q: %v", mr.Ref, err)
+			}
+			report.Indexed++
+		}
+
+		next := waiting[mr.Ref]
+		delete(waiting, mr.Ref)
+		for _, n := range next {
+			if err := indexRef(n); err != nil {
+				return err // no wrap recursive err
+			}
+		}
+		return nil
+	}
+
+	for _, mr := range mutations {
+		if p := mr.Mutation.Previous; p != "" && listed[p] && !done[p] {
+			waiting[p] = append(waiting[p], mr)
+			continue
+		}
+		if err := indexRef(mr); err != nil {
+			return Report{}, err // no wrap helper err
+		}
+	}
+
+	return report, nil
+}
+
+func verify(ctx context.Context, v Verifier, m fixity.Mutation) error {
+	if v == nil {
+		return nil
+	}
+	return v.Verify(ctx, m)
+}
+
+func indexMutation(ctx context.Context, bs fixity.BlobReader, ix index.Indexer, ref fixity.Ref, m fixity.Mutation) error {
+	var data *fixity.DataSchema
+	if m.DataSchema != "" {
+		var d fixity.DataSchema
+		if err := blobstore.ReadAndUnmarshal(ctx, bs, m.DataSchema, &d); err != nil {
+			return fmt.Errorf("read data: %v", err)
+		}
+		data = &d
+	}
+
+	var values fixity.ValuesSchema
+	if m.ValuesSchema != "" {
+		if err := blobstore.ReadAndUnmarshal(ctx, bs, m.ValuesSchema, &values); err != nil {
+			return fmt.Errorf("read values: %v", err)
+		}
+	}
+
+	if err := ix.Index(ref, m, data, values.Values); err != nil {
+		return fmt.Errorf("index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package reindex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/util/wutil"
+	"github.com/leeola/fixity/value"
+)
+
+type recordIndexer struct {
+	refs   []fixity.Ref
+	ids    []string
+	values []fixity.Values
+	resets int
+}
+
+func (ix *recordIndexer) Reset() error {
+	ix.refs, ix.ids, ix.values = nil, nil, nil
+	ix.resets++
+	return nil
+}
+
+func (ix *recordIndexer) Index(ref fixity.Ref, m fixity.Mutation, _ *fixity.DataSchema, v fixity.Values) error {
+	ix.refs = append(ix.refs, ref)
+	ix.ids = append(ix.ids, m.ID)
+	ix.values = append(ix.values, v)
+	return nil
+}
+
+// rejectVerifier rejects the mutations of the ids.
+type rejectVerifier map[string]bool
+
+func (v rejectVerifier) Verify(_ context.Context, m fixity.Mutation) error {
+	if v[m.ID] {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func writeMutation(t *testing.T, bs fixity.BlobWriter, m fixity.Mutation) fixity.Ref {
+	m.Schema = fixity.Schema{SchemaType: fixity.BlobTypeMutation}
+	ref, err := wutil.MarshalAndWrite(context.Background(), bs, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func TestReindexTimeOrder(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"c", "a", "b"} {
+		valuesRef, err := wutil.WriteValues(ctx, bs, fixity.Values{"n": value.Int(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = wutil.MarshalAndWrite(ctx, bs, fixity.Mutation{
+			Schema: fixity.Schema{
+				SchemaType: fixity.BlobTypeMutation,
+			},
+			ID:           id,
+			Time:         t0.Add(-time.Duration(i) * time.Hour),
+			ValuesSchema: valuesRef,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a non-mutation blob to be ignored.
+	if _, err := bs.Write(ctx, []byte("schemaless")); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries indexed before the reindex are reset.
+	ix := &recordIndexer{ids: []string{"stale"}}
+	report, err := Reindex(ctx, bs, ix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Indexed != 3 {
+		t.Errorf("want:3 mutations, got:%d", report.Indexed)
+	}
+
+	if ix.resets != 1 {
+		t.Errorf("want:1 reset, got:%d", ix.resets)
+	}
+
+	want := []string{"b", "a", "c"}
+	for i, id := range want {
+		if i >= len(ix.ids) || ix.ids[i] != id {
+			t.Fatalf("want order:%v, got:%v", want, ix.ids)
+		}
+	}
+
+	if n, _ := ix.values[0].Int("n"); n != 2 {
+		t.Errorf("want values of b, got:%v", ix.values[0])
+	}
+}
+
+func TestReindexPrevious(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	// versions of an equal time, and a version older than its previous.
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1 := writeMutation(t, bs, fixity.Mutation{ID: "foo", Time: t0})
+	v2 := writeMutation(t, bs, fixity.Mutation{ID: "foo", Time: t0, Previous: v1})
+	v3 := writeMutation(t, bs, fixity.Mutation{ID: "foo", Time: t0, Previous: v2})
+	v4 := writeMutation(t, bs, fixity.Mutation{ID: "foo", Time: t0.Add(-time.Hour), Previous: v3})
+
+	ix := &recordIndexer{}
+	if _, err := Reindex(ctx, bs, ix, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []fixity.Ref{v1, v2, v3, v4}
+	if len(ix.refs) != len(want) {
+		t.Fatalf("want order:%v, got:%v", want, ix.refs)
+	}
+	for i := range want {
+		if ix.refs[i] != want[i] {
+			t.Fatalf("want order:%v, got:%v", want, ix.refs)
+		}
+	}
+}
+
+func TestReindexVerify(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := writeMutation(t, bs, fixity.Mutation{ID: "foo", Time: t0})
+	forged := writeMutation(t, bs, fixity.Mutation{ID: "forged", Time: t0})
+
+	ix := &recordIndexer{}
+	report, err := Reindex(ctx, bs, ix, rejectVerifier{"forged": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Indexed != 1 || len(ix.refs) != 1 || ix.refs[0] != foo {
+		t.Errorf("want indexed:[%s], got:%v", foo, ix.refs)
+	}
+	if len(report.Unverified) != 1 || report.Unverified[0] != forged {
+		t.Errorf("want unverified:[%s], got:%v", forged, report.Unverified)
+	}
+}
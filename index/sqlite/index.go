@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/value"
+)
+
+func (ix *Index) Index(ref fixity.Ref, m fixity.Mutation, d *fixity.DataSchema, v fixity.Values) error {
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %v", err)
+	}
+
+	if err := indexTx(tx, ref, m, d, v); err != nil {
+		tx.Rollback()
+		return err // no wrap helper err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %v", err)
+	}
+
+	return nil
+}
+
+func indexTx(tx *sql.Tx, ref fixity.Ref, m fixity.Mutation, d *fixity.DataSchema, v fixity.Values) error {
+	var (
+		size     sql.NullInt64
+		checksum sql.NullString
+	)
+	if d != nil {
+		size = sql.NullInt64{Int64: d.Size, Valid: true}
+		checksum = sql.NullString{String: d.Checksum, Valid: true}
+	}
+
+	_, err := tx.Exec(`INSERT OR REPLACE INTO mutations
+		(ref, id, namespace, time, size, checksum) VALUES (?, ?, ?, ?, ?, ?)`,
+		string(ref), m.ID, m.Namespace, m.Time.UnixNano(), size, checksum)
+	if err != nil {
+		return fmt.Errorf("insert mutation: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mutation_values WHERE ref = ?`, string(ref)); err != nil {
+		return fmt.Errorf("delete values: %v", err)
+	}
+
+	for k, v := range v {
+		var intValue sql.NullInt64
+		switch v.Type {
+		case value.TypeInt:
+			intValue = sql.NullInt64{Int64: int64(v.IntValue), Valid: true}
+		case value.TypeString:
+		default:
+			return fmt.Errorf("unhandled value type: %s", v.Type)
+		}
+
+		textValue, err := v.ToString()
+		if err != nil {
+			return fmt.Errorf("value tostring: %v", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO mutation_values
+			(ref, key, type, text_value, int_value) VALUES (?, ?, ?, ?, ?)`,
+			string(ref), k, int(v.Type), textValue, intValue)
+		if err != nil {
+			return fmt.Errorf("insert value %q: %v", k, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO heads (id, ref) VALUES (?, ?)`, m.ID, string(ref))
+	if err != nil {
+		return fmt.Errorf("insert head: %v", err)
+	}
+
+	return nil
+}
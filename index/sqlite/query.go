@@ -0,0 +1,420 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/q/operator"
+	"github.com/leeola/fixity/value"
+)
+
+// projectBatchSize is the number of refs of which values are queried at a
+// time, when projecting value fields.
+const projectBatchSize = 500
+
+// columns maps the index keys to the mutations table columns. Any other
+// field is looked up in the mutation_values table.
+var columns = map[string]string{
+	index.FIDKey:        "m.id",
+	index.FRefKey:       "m.ref",
+	index.FSizeKey:      "m.size",
+	index.FChecksumKey:  "m.checksum",
+	index.FTimeKey:      "m.time",
+	index.FNamespaceKey: "m.namespace",
+}
+
+func (ix *Index) Query(qu q.Query) ([]fixity.Match, error) {
+	page, err := ix.QueryPage(qu)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	return page.Matches, nil
+}
+
+// QueryPage implements fixity.PageQuerier. Matches are ordered by time,
+// newest first, and then by ref, with cursors recording the time and ref
+// of the last match of the page.
+func (ix *Index) QueryPage(qu q.Query) (fixity.Page, error) {
+	where, args, err := fixQtoSQL(qu.Constraint)
+	if err != nil {
+		return fixity.Page{}, err // avoiding helper context to callers
+	}
+
+	if qu.Offset < 0 {
+		return fixity.Page{}, fmt.Errorf("negative offset: %d", qu.Offset)
+	}
+
+	// TODO(leeola): sort by columns and values, which requires cursors
+	// recording the sorted values.
+	if len(qu.SortBy) != 0 {
+		return fixity.Page{}, errors.New("sort keys not supported by sqlite index")
+	}
+
+	var from string
+	if qu.IncludeVersions {
+		from = "mutations m"
+	} else {
+		from = "heads h JOIN mutations m ON m.ref = h.ref"
+	}
+
+	if qu.After != "" {
+		t, ref, err := parseCursor(qu.After)
+		if err != nil {
+			return fixity.Page{}, err // avoiding helper context to callers
+		}
+		where = "(" + where + ") AND (m.time < ? OR (m.time = ? AND m.ref > ?))"
+		args = append(args, t, t, ref)
+	}
+
+	// one more match than the limit is selected, to know if there is a
+	// following page. A negative limit is no limit in sqlite.
+	limit := -1
+	if qu.LimitBy > 0 {
+		limit = qu.LimitBy + 1
+	}
+
+	query := "SELECT m.id, m.ref, m.time, m.namespace, m.size, m.checksum FROM " +
+		from + " WHERE " + where + " ORDER BY m.time DESC, m.ref LIMIT ? OFFSET ?"
+	args = append(args, limit, qu.Offset)
+
+	rows, err := ix.db.Query(query, args...)
+	if err != nil {
+		return fixity.Page{}, fmt.Errorf("query: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		page     fixity.Page
+		lastTime int64
+	)
+	for rows.Next() {
+		var (
+			id, ref, namespace string
+			t                  int64
+			size               sql.NullInt64
+			checksum           sql.NullString
+		)
+		if err := rows.Scan(&id, &ref, &t, &namespace, &size, &checksum); err != nil {
+			return fixity.Page{}, fmt.Errorf("scan: %v", err)
+		}
+
+		if qu.LimitBy > 0 && len(page.Matches) == qu.LimitBy {
+			last := page.Matches[len(page.Matches)-1]
+			page.Next = formatCursor(lastTime, last.Ref)
+			break
+		}
+
+		m := fixity.Match{
+			ID:  id,
+			Ref: fixity.Ref(ref),
+		}
+
+		if len(qu.Fields) != 0 {
+			m.Values = fixity.Values{}
+			for _, f := range qu.Fields {
+				switch f {
+				case index.FIDKey:
+					m.Values[f] = value.String(id)
+				case index.FRefKey:
+					m.Values[f] = value.String(ref)
+				case index.FNamespaceKey:
+					m.Values[f] = value.String(namespace)
+				case index.FTimeKey:
+					m.Values[f] = value.String(time.Unix(0, t).UTC().Format(time.RFC3339Nano))
+				case index.FSizeKey:
+					if size.Valid {
+						m.Values[f] = value.Int(int(size.Int64))
+					}
+				case index.FChecksumKey:
+					if checksum.Valid {
+						m.Values[f] = value.String(checksum.String)
+					}
+				}
+			}
+		}
+
+		page.Matches = append(page.Matches, m)
+		lastTime = t
+	}
+	if err := rows.Err(); err != nil {
+		return fixity.Page{}, fmt.Errorf("rows: %v", err)
+	}
+	rows.Close()
+
+	if err := ix.projectValues(page.Matches, qu.Fields); err != nil {
+		return fixity.Page{}, fmt.Errorf("projectvalues: %v", err)
+	}
+
+	return page, nil
+}
+
+// projectValues sets the requested value fields of the matches, from the
+// mutation_values table. Fields of the mutations table are ignored.
+func (ix *Index) projectValues(matches []fixity.Match, fields []string) error {
+	var keys []interface{}
+	for _, f := range fields {
+		if _, ok := columns[f]; !ok {
+			keys = append(keys, f)
+		}
+	}
+
+	if len(keys) == 0 || len(matches) == 0 {
+		return nil
+	}
+
+	byRef := make(map[fixity.Ref]fixity.Values, len(matches))
+	refs := make([]interface{}, len(matches))
+	for i, m := range matches {
+		byRef[m.Ref] = m.Values
+		refs[i] = string(m.Ref)
+	}
+
+	// batched to stay within the sqlite limit of query variables.
+	for len(refs) > 0 {
+		n := len(refs)
+		if n > projectBatchSize {
+			n = projectBatchSize
+		}
+
+		if err := ix.queryValues(byRef, refs[:n], keys); err != nil {
+			return err // no wrap helper err
+		}
+		refs = refs[n:]
+	}
+
+	return nil
+}
+
+// queryValues sets the values of the keys of the refs in byRef.
+func (ix *Index) queryValues(byRef map[fixity.Ref]fixity.Values, refs, keys []interface{}) error {
+	query := `SELECT ref, key, type, text_value, int_value FROM mutation_values
+		WHERE ref IN (` + placeholders(len(refs)) + `)
+		AND key IN (` + placeholders(len(keys)) + `)`
+
+	args := append(append([]interface{}{}, refs...), keys...)
+	rows, err := ix.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			ref, key, textValue string
+			typ                 int
+			intValue            sql.NullInt64
+		)
+		if err := rows.Scan(&ref, &key, &typ, &textValue, &intValue); err != nil {
+			return fmt.Errorf("scan: %v", err)
+		}
+
+		if value.Type(typ) == value.TypeInt && intValue.Valid {
+			byRef[fixity.Ref(ref)][key] = value.Int(int(intValue.Int64))
+		} else {
+			byRef[fixity.Ref(ref)][key] = value.String(textValue)
+		}
+	}
+
+	return rows.Err()
+}
+
+// placeholders returns n comma separated sql placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// formatCursor returns the cursor following the mutation of the time and
+// ref.
+func formatCursor(t int64, ref fixity.Ref) string {
+	return strconv.FormatInt(t, 10) + ":" + string(ref)
+}
+
+func parseCursor(cursor string) (int64, string, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", fmt.Errorf("invalid cursor: %q", cursor)
+	}
+
+	t, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor: %q", cursor)
+	}
+
+	return t, parts[1], nil
+}
+
+// fixQtoSQL translates the constraint into a SQL expression and its
+// arguments, evaluated against the mutations table aliased as m.
+func fixQtoSQL(c q.Constraint) (string, []interface{}, error) {
+	switch c.Operator {
+	case operator.Equal:
+		if c.Value == nil {
+			return "", nil, fmt.Errorf("field or value nil on equal op")
+		}
+		s, err := c.Value.ToString()
+		if err != nil {
+			return "", nil, fmt.Errorf("equal tostring: %v", err)
+		}
+
+		// allow fieldless matches
+		if c.Field == nil {
+			return `(m.id = ? OR m.ref = ? OR m.checksum = ? OR EXISTS (
+				SELECT 1 FROM mutation_values v
+				WHERE v.ref = m.ref AND v.text_value = ?))`,
+				[]interface{}{s, s, s, s}, nil
+		}
+
+		if *c.Field == index.FTimeKey {
+			t, err := index.ParseTime(*c.Value)
+			if err != nil {
+				return "", nil, err // no wrap helper err
+			}
+			return columns[index.FTimeKey] + " = ?", []interface{}{t.UnixNano()}, nil
+		}
+
+		if column, ok := columns[*c.Field]; ok {
+			return column + " = ?", []interface{}{s}, nil
+		}
+
+		return `EXISTS (SELECT 1 FROM mutation_values v
+			WHERE v.ref = m.ref AND v.key = ? AND v.text_value = ?)`,
+			[]interface{}{*c.Field, s}, nil
+
+	case operator.Gt, operator.Gte, operator.Lt, operator.Lte, operator.Between:
+		return rangeSQL(c)
+
+	case operator.And, operator.Or:
+		if len(c.SubConstraints) == 0 {
+			return "", nil, fmt.Errorf("%s op missing subconstraints", c.Operator)
+		}
+
+		exprs := make([]string, len(c.SubConstraints))
+		var args []interface{}
+		for i, sc := range c.SubConstraints {
+			expr, scArgs, err := fixQtoSQL(sc)
+			if err != nil {
+				return "", nil, err
+			}
+			exprs[i] = "(" + expr + ")"
+			args = append(args, scArgs...)
+		}
+
+		if c.Operator == operator.Or {
+			return strings.Join(exprs, " OR "), args, nil
+		}
+		return strings.Join(exprs, " AND "), args, nil
+
+	case operator.Not:
+		if len(c.SubConstraints) != 1 {
+			return "", nil, fmt.Errorf("not op requires one subconstraint, got %d", len(c.SubConstraints))
+		}
+		expr, args, err := fixQtoSQL(c.SubConstraints[0])
+		if err != nil {
+			return "", nil, err
+		}
+		// comparisons of null columns, such as the size of mutations
+		// without data, are null rather than false.
+		return "NOT COALESCE((" + expr + "), 0)", args, nil
+
+	default:
+		return "", nil, fmt.Errorf("unsupported constraint operator: %q", c.Operator)
+	}
+}
+
+// rangeSQL translates a range constraint into comparisons of the column
+// of the field, or of the mutation value of the field. Int values compare
+// against int_value, so string values never satisfy an int range.
+func rangeSQL(c q.Constraint) (string, []interface{}, error) {
+	lower, upper, err := q.RangeBounds(c)
+	if err != nil {
+		return "", nil, err // no wrap helper err
+	}
+
+	column, isColumn := columns[*c.Field]
+
+	var (
+		exprs []string
+		args  []interface{}
+	)
+	for _, b := range []struct {
+		bound       *q.Bound
+		op, opEqual string
+	}{
+		{lower, ">", ">="},
+		{upper, "<", "<="},
+	} {
+		if b.bound == nil {
+			continue
+		}
+
+		op := b.op
+		if b.bound.Inclusive {
+			op = b.opEqual
+		}
+
+		var (
+			arg      interface{}
+			valueCol = "v.text_value"
+		)
+		switch {
+		case *c.Field == index.FTimeKey:
+			t, err := index.ParseTime(b.bound.Value)
+			if err != nil {
+				return "", nil, err // no wrap helper err
+			}
+			arg = t.UnixNano()
+		case b.bound.Value.Type == value.TypeInt:
+			arg = int64(b.bound.Value.IntValue)
+			valueCol = "v.int_value"
+		default:
+			arg = b.bound.Value.StringValue
+		}
+
+		if isColumn {
+			exprs = append(exprs, column+" "+op+" ?")
+		} else {
+			exprs = append(exprs, valueCol+" "+op+" ?")
+		}
+		args = append(args, arg)
+	}
+
+	expr := strings.Join(exprs, " AND ")
+	if isColumn {
+		return expr, args, nil
+	}
+
+	return `EXISTS (SELECT 1 FROM mutation_values v
+		WHERE v.ref = m.ref AND v.key = ? AND ` + expr + `)`,
+		append([]interface{}{*c.Field}, args...), nil
+}
+
+// List implements index.Lister, listing every mutation and every head.
+func (ix *Index) List(fn func(fixity.Match) error) error {
+	rows, err := ix.db.Query(`SELECT id, ref FROM mutations
+		UNION ALL SELECT id, ref FROM heads`)
+	if err != nil {
+		return fmt.Errorf("query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, ref string
+		if err := rows.Scan(&id, &ref); err != nil {
+			return fmt.Errorf("scan: %v", err)
+		}
+
+		if err := fn(fixity.Match{ID: id, Ref: fixity.Ref(ref)}); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/leeola/fixity/config"
+	"github.com/leeola/fixity/util/pathutil"
+	// register the sqlite3 database/sql driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const dbFile = "index.sqlite"
+
+// schema creates the tables of the index.
+//
+// mutations contains every indexed mutation, the equivalent of the bleve
+// ref index. heads contains the latest indexed mutation of each id, the
+// equivalent of the bleve id index. mutation_values contains the values
+// of each mutation, with text_value holding the string form of every value
+// and int_value only set for int values.
+const schema = `
+CREATE TABLE IF NOT EXISTS mutations (
+	ref       TEXT PRIMARY KEY,
+	id        TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	time      INTEGER NOT NULL,
+	size      INTEGER,
+	checksum  TEXT
+);
+
+CREATE INDEX IF NOT EXISTS mutations_id ON mutations (id);
+
+CREATE TABLE IF NOT EXISTS heads (
+	id  TEXT PRIMARY KEY,
+	ref TEXT NOT NULL REFERENCES mutations (ref)
+);
+
+CREATE TABLE IF NOT EXISTS mutation_values (
+	ref        TEXT NOT NULL REFERENCES mutations (ref),
+	key        TEXT NOT NULL,
+	type       INTEGER NOT NULL,
+	text_value TEXT NOT NULL,
+	int_value  INTEGER,
+	PRIMARY KEY (ref, key)
+);
+
+CREATE INDEX IF NOT EXISTS mutation_values_key ON mutation_values (key, text_value);
+`
+
+type Config struct {
+	Path string `json:"path"`
+}
+
+// Index implements a Fixity Index stored in a SQLite database.
+//
+// Mutation times are stored as unix nanoseconds in UTC.
+type Index struct {
+	db *sql.DB
+}
+
+func New(name string, cfg config.Config) (*Index, error) {
+	var c Config
+	if err := cfg.IndexConfig(name, &c); err != nil {
+		return nil, fmt.Errorf("indexconfig: %v", err)
+	}
+
+	rootPath, err := pathutil.ExpandJoin(cfg.RootPath, c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("expandjoin: %v", err)
+	}
+
+	if rootPath == "" {
+		return nil, fmt.Errorf("rootpath and sqlite path empty")
+	}
+
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return nil, fmt.Errorf("mkdirall %s: %v", rootPath, err)
+	}
+
+	return Open(filepath.Join(rootPath, dbFile))
+}
+
+// Open opens or creates the sqlite index database at the given path.
+func Open(path string) (*Index, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("sql open: %v", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %v", err)
+	}
+
+	return &Index{
+		db: db,
+	}, nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// Reset implements index.Resetter, deleting every indexed mutation.
+func (ix *Index) Reset() error {
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %v", err)
+	}
+
+	// values and heads reference mutations, so are deleted first.
+	for _, table := range []string{"mutation_values", "heads", "mutations"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("delete %s: %v", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %v", err)
+	}
+
+	return nil
+}
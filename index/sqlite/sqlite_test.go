@@ -0,0 +1,308 @@
+package sqlite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/q/operator"
+	"github.com/leeola/fixity/value"
+)
+
+func TestIndexQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ix, err := Open(filepath.Join(dir, dbFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	writes := []struct {
+		Ref    fixity.Ref
+		ID     string
+		Time   time.Time
+		Data   *fixity.DataSchema
+		Values fixity.Values
+	}{
+		{"ref1", "foo", t0, &fixity.DataSchema{Size: 5, Checksum: "c1"},
+			fixity.Values{"name": value.String("a"), "n": value.Int(1)}},
+		{"ref2", "foo", t0.Add(time.Second), &fixity.DataSchema{Size: 7, Checksum: "c2"},
+			fixity.Values{"name": value.String("b"), "n": value.Int(2)}},
+		{"ref3", "bar", t0.Add(2 * time.Second), nil,
+			fixity.Values{"name": value.String("a")}},
+	}
+	for _, w := range writes {
+		m := fixity.Mutation{ID: w.ID, Time: w.Time}
+		if err := ix.Index(w.Ref, m, w.Data, w.Values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		Name  string
+		Query q.Query
+		Want  []fixity.Ref
+	}{
+		{"head id", q.New().Eq(index.FIDKey, value.String("foo")),
+			[]fixity.Ref{"ref2"}},
+		{"versions id", q.New().WithVersions().Eq(index.FIDKey, value.String("foo")),
+			[]fixity.Ref{"ref2", "ref1"}},
+		{"value", q.New().WithVersions().Eq("name", value.String("a")),
+			[]fixity.Ref{"ref3", "ref1"}},
+		{"int value", q.New().WithVersions().Eq("n", value.String("2")),
+			[]fixity.Ref{"ref2"}},
+		{"size", q.New().Eq(index.FSizeKey, value.Int(7)),
+			[]fixity.Ref{"ref2"}},
+		{"fieldless", q.New().WithVersions().Const(q.Constraint{
+			Operator: operator.Equal, Value: valuePtr(value.String("c1"))}),
+			[]fixity.Ref{"ref1"}},
+		{"and", q.New().WithVersions().Const(q.And(
+			q.Eq("name", value.String("a")),
+			q.Eq(index.FIDKey, value.String("bar")))),
+			[]fixity.Ref{"ref3"}},
+		{"size gt", q.New().Gt(index.FSizeKey, value.Int(5)),
+			[]fixity.Ref{"ref2"}},
+		{"int value gte", q.New().WithVersions().Gte("n", value.Int(1)),
+			[]fixity.Ref{"ref2", "ref1"}},
+		{"int value between", q.New().WithVersions().Between("n", value.Int(0), value.Int(1)),
+			[]fixity.Ref{"ref1"}},
+		{"string value lt", q.New().WithVersions().Lt("name", value.String("b")),
+			[]fixity.Ref{"ref3", "ref1"}},
+		{"string value lte", q.New().WithVersions().Lte("name", value.String("b")),
+			[]fixity.Ref{"ref3", "ref2", "ref1"}},
+		{"time gt", q.New().WithVersions().Gt(index.FTimeKey, value.String("2017-01-01T00:00:00Z")),
+			[]fixity.Ref{"ref3", "ref2"}},
+		{"time between dates", q.New().WithVersions().Between(index.FTimeKey,
+			value.String("2016-12-31"), value.String("2017-01-01")),
+			[]fixity.Ref{"ref1"}},
+		{"or", q.New().WithVersions().Or(
+			q.Eq("name", value.String("b")),
+			q.Eq(index.FIDKey, value.String("bar"))),
+			[]fixity.Ref{"ref3", "ref2"}},
+		{"not", q.New().WithVersions().Not(q.Eq("name", value.String("a"))),
+			[]fixity.Ref{"ref2"}},
+		{"not size", q.New().WithVersions().Not(q.Eq(index.FSizeKey, value.Int(7))),
+			[]fixity.Ref{"ref3", "ref1"}},
+		{"time", q.New().WithVersions().Eq(index.FTimeKey, value.String("2017-01-01T00:00:01Z")),
+			[]fixity.Ref{"ref2"}},
+		{"limit", q.Query{LimitBy: 1, IncludeVersions: true,
+			Constraint: q.Eq(index.FIDKey, value.String("foo"))},
+			[]fixity.Ref{"ref2"}},
+	}
+	for _, tc := range testCases {
+		matches, err := ix.Query(tc.Query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+
+		var got []fixity.Ref
+		for _, m := range matches {
+			got = append(got, m.Ref)
+		}
+
+		if len(got) != len(tc.Want) {
+			t.Errorf("%s want:%v, got:%v", tc.Name, tc.Want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.Want[i] {
+				t.Errorf("%s want:%v, got:%v", tc.Name, tc.Want, got)
+				break
+			}
+		}
+	}
+}
+
+func valuePtr(v value.Value) *value.Value {
+	return &v
+}
+
+func TestQueryPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ix, err := Open(filepath.Join(dir, dbFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var want []fixity.Ref
+	for i := 0; i < 25; i++ {
+		ref := fixity.Ref(fmt.Sprintf("ref%02d", i))
+		// pairs of mutations share a time, to page within equal times.
+		m := fixity.Mutation{ID: fmt.Sprintf("id%02d", i), Time: t0.Add(time.Duration(i/2) * time.Second)}
+		if err := ix.Index(ref, m, nil, fixity.Values{"kind": value.String("page")}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, ref)
+	}
+	// newest first, then by ref.
+	sort.Slice(want, func(i, j int) bool {
+		var a, b int
+		fmt.Sscanf(string(want[i]), "ref%d", &a)
+		fmt.Sscanf(string(want[j]), "ref%d", &b)
+		if a/2 != b/2 {
+			return a/2 > b/2
+		}
+		return a < b
+	})
+
+	qu := q.New().WithLimit(10).Eq("kind", value.String("page"))
+
+	var (
+		got   []fixity.Ref
+		pages int
+	)
+	for {
+		page, err := ix.QueryPage(qu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, m := range page.Matches {
+			got = append(got, m.Ref)
+		}
+		if page.Next == "" {
+			break
+		}
+		qu = qu.WithAfter(page.Next)
+	}
+
+	if pages != 3 {
+		t.Errorf("want 3 pages, got:%d", pages)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want:%v, got:%v", want, got)
+	}
+
+	page, err := ix.QueryPage(q.New().WithLimit(0).WithOffset(20).Eq("kind", value.String("page")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Matches) != 5 || page.Next != "" || page.Matches[0].Ref != want[20] {
+		t.Errorf("want the last 5 matches without a cursor, got:%+v", page)
+	}
+
+	if _, err := ix.QueryPage(qu.WithAfter("bad")); err == nil {
+		t.Error("want error for an invalid cursor")
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ix, err := Open(filepath.Join(dir, dbFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := fixity.Mutation{ID: "foo", Namespace: "docs", Time: t0}
+	d := &fixity.DataSchema{Size: 5, Checksum: "c1"}
+	v := fixity.Values{"name": value.String("a"), "n": value.Int(1), "other": value.String("x")}
+	if err := ix.Index("ref1", m, d, v); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Index("ref2", fixity.Mutation{ID: "bar", Time: t0}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := []string{"name", "n", "missing", index.FSizeKey, index.FChecksumKey,
+		index.FTimeKey, index.FNamespaceKey}
+	matches, err := ix.Query(q.New().WithFields(fields...).Eq(index.FIDKey, value.String("foo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("want 1 match, got:%v", matches)
+	}
+
+	want := fixity.Values{
+		"name":              value.String("a"),
+		"n":                 value.Int(1),
+		index.FSizeKey:      value.Int(5),
+		index.FChecksumKey:  value.String("c1"),
+		index.FTimeKey:      value.String("2017-01-01T00:00:00Z"),
+		index.FNamespaceKey: value.String("docs"),
+	}
+	if fmt.Sprint(matches[0].Values) != fmt.Sprint(want) {
+		t.Errorf("want:%v, got:%v", want, matches[0].Values)
+	}
+
+	// data fields are omitted for mutations without data.
+	matches, err = ix.Query(q.New().WithFields(fields...).Eq(index.FIDKey, value.String("bar")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || len(matches[0].Values) != 2 {
+		t.Errorf("want time and namespace values, got:%v", matches)
+	}
+
+	// without fields, no values are returned.
+	matches, err = ix.Query(q.New().Eq(index.FIDKey, value.String("foo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Values != nil {
+		t.Errorf("want no values, got:%v", matches)
+	}
+}
+
+func TestReset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixity-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ix, err := Open(filepath.Join(dir, dbFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	m := fixity.Mutation{ID: "foo", Time: time.Now()}
+	if err := ix.Index("ref1", m, nil, fixity.Values{"name": value.String("a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, qu := range []q.Query{
+		q.New().Eq(index.FIDKey, value.String("foo")),
+		q.New().WithVersions().Eq("name", value.String("a")),
+	} {
+		matches, err := ix.Query(qu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 0 {
+			t.Errorf("want no matches after reset, got:%v", matches)
+		}
+	}
+}
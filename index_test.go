@@ -0,0 +1,41 @@
+package fixity
+
+import (
+	"testing"
+
+	"github.com/leeola/fixity/q"
+)
+
+// sliceQuerier implements only Querier, applying the limit of the query.
+type sliceQuerier []Match
+
+func (qr sliceQuerier) Query(qu q.Query) ([]Match, error) {
+	if qu.LimitBy > 0 && qu.LimitBy < len(qr) {
+		return qr[:qu.LimitBy], nil
+	}
+	return qr, nil
+}
+
+func TestQueryPage(t *testing.T) {
+	qr := sliceQuerier{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+
+	page, err := QueryPage(qr, q.New().WithLimit(2).WithOffset(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Matches) != 2 || page.Matches[0].ID != "b" || page.Matches[1].ID != "c" {
+		t.Errorf("want matches b and c, got:%v", page.Matches)
+	}
+	if page.Next != "" {
+		t.Errorf("want no cursor, got:%q", page.Next)
+	}
+
+	page, err = QueryPage(qr, q.New().WithLimit(0).WithOffset(5))
+	if err != nil || len(page.Matches) != 0 {
+		t.Errorf("want no matches beyond the offset, got:%v, %v", page.Matches, err)
+	}
+
+	if _, err := QueryPage(qr, q.New().WithAfter("cursor")); err == nil {
+		t.Error("want error for a cursor")
+	}
+}
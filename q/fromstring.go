@@ -1,87 +1,240 @@
 package q
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/leeola/fixity/q/operator"
 	"github.com/leeola/fixity/value"
-	"github.com/mgutz/str"
 )
 
 // FromString produces a Query from the given string.
 //
-// Intended for constructing Queries from user input.
+// Intended for constructing Queries from user input. The grammar is:
 //
-// TODO(leeola): support AND/OR by looking check if one of the parts equals
-// AND/OR directly. Can also support -AND and -OR. Though i may have to
-// implement my own parsing, to group ( and ), eg AND( ... ).
-func FromString(s string) Query {
-	parts := str.ToArgv(s)
-
-	// the fieldless constraint is any parts that do not produce
-	// another type of constraint. Ie, the resulting string.
-	var fieldless []string
-
-	var cs []Constraint
-	for _, p := range parts {
-		op, field, valueStr := splitPart(p)
-
-		if op == "" && field == "" {
-			fieldless = append(fieldless, valueStr)
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }
+//	unary   = "NOT" unary | "(" or ")" | term
+//	term    = value | field ":" value | op ":" field ":" value
+//
+// Terms without an operator between them are ANDed, and adjacent fieldless
+// values are joined with a space into a single value. Ops are eq, gt, gte,
+// lt, lte and between, the value of between being "lower..upper". Range
+// values are ints if they parse as ints and are not quoted.
+//
+// Keywords are only recognized when upper case and unquoted. Any error is
+// a *ParseError.
+func FromString(s string) (Query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return Query{}, err // no wrap helper err
+	}
+
+	if toks[0].typ == tokenEOF {
+		return Query{}, &ParseError{Pos: 0, Msg: "empty query"}
+	}
+
+	p := &parser{toks: toks}
+	c, err := p.parseOr()
+	if err != nil {
+		return Query{}, err // no wrap helper err
+	}
+
+	if t := p.peek(); t.typ != tokenEOF {
+		return Query{}, p.errorf(t, "unexpected %s", t)
+	}
+
+	return New().Const(c), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	// the final eof token is never consumed.
+	if t.typ != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// endsAnd reports whether the token ends a sequence of and terms.
+func endsAnd(t token) bool {
+	return t.typ == tokenEOF || t.typ == tokenRParen || t.keyword("OR")
+}
+
+func (p *parser) parseOr() (Constraint, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return Constraint{}, err
+	}
+
+	cs := []Constraint{c}
+	for p.peek().keyword("OR") {
+		p.next()
+
+		c, err := p.parseAnd()
+		if err != nil {
+			return Constraint{}, err
+		}
+		cs = append(cs, c)
+	}
+
+	return Or(cs...), nil
+}
+
+func (p *parser) parseAnd() (Constraint, error) {
+	var (
+		cs []Constraint
+		// fieldless are the adjacent fieldless values not yet joined.
+		fieldless []string
+	)
+	flush := func() {
+		if len(fieldless) != 0 {
+			v := value.String(strings.Join(fieldless, " "))
+			cs = append(cs, Constraint{
+				Operator: operator.Equal,
+				Value:    &v,
+			})
+			fieldless = nil
+		}
+	}
+
+	if t := p.peek(); endsAnd(t) || t.keyword("AND") {
+		return Constraint{}, p.errorf(t, "expected expression, got %s", t)
+	}
+
+	for !endsAnd(p.peek()) {
+		if t := p.peek(); t.keyword("AND") {
+			p.next()
+			if t := p.peek(); endsAnd(t) || t.keyword("AND") {
+				return Constraint{}, p.errorf(t, "expected expression after AND, got %s", t)
+			}
+			flush()
 			continue
 		}
 
-		switch op {
-		case "eq":
-			op = operator.Equal
+		t := p.peek()
+		if t.typ == tokenWord && !t.keyword("NOT") && len(t.colons) == 0 {
+			p.next()
+			fieldless = append(fieldless, t.text)
+			continue
+		}
+
+		flush()
+		c, err := p.parseUnary()
+		if err != nil {
+			return Constraint{}, err
+		}
+		cs = append(cs, c)
+	}
+	flush()
+
+	return And(cs...), nil
+}
+
+func (p *parser) parseUnary() (Constraint, error) {
+	t := p.next()
+	switch {
+	case t.keyword("NOT"):
+		if t := p.peek(); endsAnd(t) || t.keyword("AND") {
+			return Constraint{}, p.errorf(t, "expected expression after NOT, got %s", t)
+		}
+		c, err := p.parseUnary()
+		if err != nil {
+			return Constraint{}, err
+		}
+		return Not(c), nil
 
-		case "":
-			// default empty ops to equal.
-			//
-			// in the future it should probably translate to some type of loose
-			// operator, maybe fts?
-			op = operator.Equal
+	case t.typ == tokenLParen:
+		c, err := p.parseOr()
+		if err != nil {
+			return Constraint{}, err
 		}
+		if end := p.next(); end.typ != tokenRParen {
+			return Constraint{}, p.errorf(end, "missing closing parenthesis for %d", t.pos)
+		}
+		return c, nil
 
-		v := value.String(valueStr)
+	case t.typ == tokenWord:
+		return p.term(t)
 
-		cs = append(cs, Constraint{
-			Operator: op,
-			Field:    &field,
-			Value:    &v,
-		})
+	default:
+		return Constraint{}, p.errorf(t, "expected expression, got %s", t)
 	}
+}
 
-	if len(fieldless) != 0 {
-		v := value.String(strings.Join(fieldless, " "))
-		cs = append(cs, Constraint{
+// term returns the constraint of a word.
+func (p *parser) term(t token) (Constraint, error) {
+	if len(t.colons) == 0 {
+		v := value.String(t.text)
+		return Constraint{
 			Operator: operator.Equal,
 			Value:    &v,
-		})
+		}, nil
 	}
 
-	if len(cs) == 1 {
-		return New().Const(cs[0])
+	// "field:value"
+	op, field, valueStart := "", t.text[:t.colons[0]], t.colons[0]+1
+	if len(t.colons) > 1 {
+		// "op:field:value"
+		op = t.text[:t.colons[0]]
+		field = t.text[t.colons[0]+1 : t.colons[1]]
+		valueStart = t.colons[1] + 1
 	}
+	valueStr := t.text[valueStart:]
+	quoted := t.quotedFrom != -1 && t.quotedFrom >= valueStart
 
-	return New().And(cs...)
-}
+	if field == "" {
+		return Constraint{}, p.errorf(t, "empty field in %s", t)
+	}
+
+	// rangeValue returns an int value for unquoted ints, to compare
+	// numerically, and a string value otherwise.
+	rangeValue := func(s string) value.Value {
+		if !quoted {
+			if i, err := strconv.Atoi(s); err == nil {
+				return value.Int(i)
+			}
+		}
+		return value.String(s)
+	}
+
+	switch op {
+	case "", "eq", operator.Equal:
+		// in the future an empty op should probably translate to some type
+		// of loose operator, maybe fts?
+		return Eq(field, value.String(valueStr)), nil
+
+	case operator.Gt, operator.Gte, operator.Lt, operator.Lte:
+		return compare(op, field, rangeValue(valueStr)), nil
+
+	case operator.Between:
+		bounds := strings.SplitN(valueStr, "..", 2)
+		if len(bounds) != 2 {
+			return Constraint{}, p.errorf(t, "between value must be lower..upper, got %q", valueStr)
+		}
+
+		lower, upper := rangeValue(bounds[0]), rangeValue(bounds[1])
+		if lower.Type != upper.Type {
+			return Constraint{}, p.errorf(t, "between bounds of different types in %s", t)
+		}
+		return Between(field, lower, upper), nil
 
-func splitPart(s string) (op, field, value string) {
-	constStrs := strings.SplitN(s, ":", 3)
-	switch len(constStrs) {
-	case 1:
-		// "value"
-		value = constStrs[0]
-	case 2:
-		// "field:value"
-		field = constStrs[0]
-		value = constStrs[1]
 	default:
-		// "op:field:value"
-		op = constStrs[0]
-		field = constStrs[1]
-		value = constStrs[2]
+		return Constraint{}, p.errorf(t, "unknown operator %q", op)
 	}
-	return
 }
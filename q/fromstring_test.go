@@ -0,0 +1,125 @@
+package q
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leeola/fixity/q/operator"
+	"github.com/leeola/fixity/value"
+)
+
+func fieldless(s string) Constraint {
+	v := value.String(s)
+	return Constraint{Operator: operator.Equal, Value: &v}
+}
+
+func TestFromString(t *testing.T) {
+	tests := []struct {
+		Query string
+		Want  Constraint
+	}{
+		{`foo`, fieldless("foo")},
+		{`foo bar`, fieldless("foo bar")},
+		{`foo AND bar`, And(fieldless("foo"), fieldless("bar"))},
+		{`name:foo`, Eq("name", value.String("foo"))},
+		{`eq:name:foo`, Eq("name", value.String("foo"))},
+		{`name:"foo bar"`, Eq("name", value.String("foo bar"))},
+		{`"a:b"`, fieldless("a:b")},
+		{`name:"a:b"`, Eq("name", value.String("a:b"))},
+		{`"with \"quotes\""`, fieldless(`with "quotes"`)},
+		{`'OR'`, fieldless("OR")},
+		{`and or not`, fieldless("and or not")},
+		{`foo name:bar baz`, And(fieldless("foo"), Eq("name", value.String("bar")), fieldless("baz"))},
+		{`a:1 OR a:2 b:3`, Or(
+			Eq("a", value.String("1")),
+			And(Eq("a", value.String("2")), Eq("b", value.String("3"))))},
+		{`(a:1 OR a:2) b:3`, And(
+			Or(Eq("a", value.String("1")), Eq("a", value.String("2"))),
+			Eq("b", value.String("3")))},
+		{`NOT a:1`, Not(Eq("a", value.String("1")))},
+		{`NOT NOT (foo)`, Not(Not(fieldless("foo")))},
+		{`a:1 NOT (b:2 OR c:3)`, And(
+			Eq("a", value.String("1")),
+			Not(Or(Eq("b", value.String("2")), Eq("c", value.String("3")))))},
+		{`gt:fsize:1073741824`, Gt("fsize", value.Int(1073741824))},
+		{`lte:name:b`, Lte("name", value.String("b"))},
+		{`gte:n:"5"`, Gte("n", value.String("5"))},
+		{`between:date:2017-01-01..2017-12-31`,
+			Between("date", value.String("2017-01-01"), value.String("2017-12-31"))},
+		{`between:n:1..5`, Between("n", value.Int(1), value.Int(5))},
+	}
+
+	for _, test := range tests {
+		qu, err := FromString(test.Query)
+		if err != nil {
+			t.Errorf("%s: %v", test.Query, err)
+			continue
+		}
+		if !reflect.DeepEqual(qu.Constraint, test.Want) {
+			t.Errorf("%s want:%+v, got:%+v", test.Query, test.Want, qu.Constraint)
+		}
+	}
+}
+
+func TestFromStringErrors(t *testing.T) {
+	tests := []struct {
+		Query string
+		Pos   int
+	}{
+		{``, 0},
+		{`   `, 0},
+		{`(foo`, 4},
+		{`foo)`, 3},
+		{`()`, 1},
+		{`foo OR`, 6},
+		{`OR foo`, 0},
+		{`AND foo`, 0},
+		{`foo AND AND bar`, 8},
+		{`foo NOT`, 7},
+		{`name:"foo`, 5},
+		{`bad:name:foo`, 0},
+		{`eq::foo`, 0},
+		{`between:n:1`, 0},
+		{`between:n:1..b`, 0},
+	}
+
+	for _, test := range tests {
+		_, err := FromString(test.Query)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q want parse error, got:%v", test.Query, err)
+			continue
+		}
+		if pe.Pos != test.Pos {
+			t.Errorf("%q want pos:%d, got:%v", test.Query, test.Pos, pe)
+		}
+	}
+}
+
+func TestQueryAnd(t *testing.T) {
+	a, b := Eq("a", value.Int(1)), Eq("b", value.Int(2))
+
+	if got := New().And(a, b).Constraint; !reflect.DeepEqual(got, And(a, b)) {
+		t.Errorf("want and constraint, got:%+v", got)
+	}
+	if got := New().Or(a, b).Constraint; !reflect.DeepEqual(got, Or(a, b)) {
+		t.Errorf("want or constraint, got:%+v", got)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	keys, err := ParseSort("-fsize, name,+ftime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SortKey{Desc("fsize"), Asc("name"), Asc("ftime")}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("want:%v, got:%v", want, keys)
+	}
+
+	for _, s := range []string{"", "-", "name,,fid"} {
+		if _, err := ParseSort(s); err == nil {
+			t.Errorf("%q want error", s)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package q
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError is returned by FromString for queries that cannot be parsed.
+type ParseError struct {
+	// Pos is the byte offset of the error within the query string.
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at %d: %s", e.Pos, e.Msg)
+}
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenWord
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	typ tokenType
+	pos int
+
+	// text is the unquoted text of a word.
+	text string
+
+	// colons are the offsets within text of colons outside of quotes,
+	// separating the op, field and value of a word.
+	colons []int
+
+	// quotedFrom is the offset within text of the first quoted byte, or -1
+	// if no part of the word is quoted.
+	quotedFrom int
+}
+
+// keyword reports whether the token is the given unquoted keyword.
+func (t token) keyword(k string) bool {
+	return t.typ == tokenWord && t.quotedFrom == -1 && t.text == k
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of query"
+	case tokenLParen:
+		return `"("`
+	case tokenRParen:
+		return `")"`
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lex splits the query string into words and parentheses.
+//
+// Words are separated by whitespace and parentheses, unless quoted with
+// double or single quotes. Within double quotes a backslash escapes the
+// following character.
+func lex(s string) ([]token, error) {
+	var toks []token
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			toks = append(toks, token{typ: tokenLParen, pos: i})
+			i += size
+		case r == ')':
+			toks = append(toks, token{typ: tokenRParen, pos: i})
+			i += size
+		default:
+			tok, n, err := lexWord(s, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+			i = n
+		}
+	}
+
+	return append(toks, token{typ: tokenEOF, pos: len(s)}), nil
+}
+
+// lexWord lexes the word starting at offset i, returning the offset
+// following it.
+func lexWord(s string, i int) (token, int, error) {
+	tok := token{typ: tokenWord, pos: i, quotedFrom: -1}
+
+	var text []byte
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		if unicode.IsSpace(r) || r == '(' || r == ')' {
+			break
+		}
+
+		if r != '"' && r != '\'' {
+			if r == ':' {
+				tok.colons = append(tok.colons, len(text))
+			}
+			text = append(text, s[i:i+size]...)
+			i += size
+			continue
+		}
+
+		if tok.quotedFrom == -1 {
+			tok.quotedFrom = len(text)
+		}
+
+		quote, start := s[i], i
+		for i++; ; i++ {
+			if i >= len(s) {
+				return token{}, 0, &ParseError{Pos: start, Msg: "unterminated quote"}
+			}
+			if s[i] == quote {
+				i++
+				break
+			}
+			if quote == '"' && s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			text = append(text, s[i])
+		}
+	}
+
+	tok.text = string(text)
+	return tok, i, nil
+}
@@ -3,4 +3,14 @@ package operator
 const (
 	Equal = "equal"
 	And   = "and"
+	Or    = "or"
+	Not   = "not"
+
+	// range operators, compared numerically for int values and lexically
+	// for string values.
+	Gt      = "gt"
+	Gte     = "gte"
+	Lt      = "lt"
+	Lte     = "lte"
+	Between = "between"
 )
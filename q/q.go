@@ -6,16 +6,54 @@ import (
 )
 
 type Constraint struct {
-	Operator       string       `json:"operator"`
-	Field          *string      `json:"field,omitempty"`
-	Value          *value.Value `json:"value,omitempty"`
+	Operator string       `json:"operator"`
+	Field    *string      `json:"field,omitempty"`
+	Value    *value.Value `json:"value,omitempty"`
+	// Upper is the upper bound of a Between constraint, with Value being
+	// the lower bound.
+	Upper          *value.Value `json:"upper,omitempty"`
 	SubConstraints []Constraint `json:"subConstraints,omitempty"`
 }
 
 type Query struct {
 	IncludeVersions bool
-	LimitBy         int
-	Constraint      Constraint
+
+	// LimitBy is the maximum number of matches returned, with zero
+	// returning every match.
+	LimitBy int
+
+	// Offset skips the first matches, following the After cursor if any.
+	Offset int
+
+	// After is the cursor of a previous query, returned as its Page.Next,
+	// to continue from the matches following it. Cursors are specific to
+	// the index that returned them.
+	After string
+
+	// SortBy orders the matches by each key in turn. Without sort keys the
+	// order is chosen by the index.
+	SortBy []SortKey
+
+	// Fields are the value fields and index keys, such as fsize, returned
+	// in the Values of each match.
+	Fields []string
+
+	Constraint Constraint
+}
+
+// SortKey is a field that matches are ordered by, ascending unless
+// Descending.
+type SortKey struct {
+	Field      string `json:"field"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+func Asc(field string) SortKey {
+	return SortKey{Field: field}
+}
+
+func Desc(field string) SortKey {
+	return SortKey{Field: field, Descending: true}
 }
 
 func New() Query {
@@ -35,6 +73,31 @@ func (q Query) WithoutVersions() Query {
 	return q
 }
 
+func (q Query) WithLimit(n int) Query {
+	q.LimitBy = n
+	return q
+}
+
+func (q Query) WithOffset(n int) Query {
+	q.Offset = n
+	return q
+}
+
+func (q Query) WithAfter(cursor string) Query {
+	q.After = cursor
+	return q
+}
+
+func (q Query) WithSort(keys ...SortKey) Query {
+	q.SortBy = keys
+	return q
+}
+
+func (q Query) WithFields(fields ...string) Query {
+	q.Fields = fields
+	return q
+}
+
 func (q Query) Const(c Constraint) Query {
 	q.Constraint = c
 	return q
@@ -52,9 +115,75 @@ func Eq(field string, value value.Value) Constraint {
 	}
 }
 
+func (q Query) Gt(field string, value value.Value) Query {
+	return q.Const(Gt(field, value))
+}
+
+func (q Query) Gte(field string, value value.Value) Query {
+	return q.Const(Gte(field, value))
+}
+
+func (q Query) Lt(field string, value value.Value) Query {
+	return q.Const(Lt(field, value))
+}
+
+func (q Query) Lte(field string, value value.Value) Query {
+	return q.Const(Lte(field, value))
+}
+
+func (q Query) Between(field string, lower, upper value.Value) Query {
+	return q.Const(Between(field, lower, upper))
+}
+
+// Gt requires the field to be greater than the value.
+func Gt(field string, value value.Value) Constraint {
+	return compare(operator.Gt, field, value)
+}
+
+// Gte requires the field to be greater than or equal to the value.
+func Gte(field string, value value.Value) Constraint {
+	return compare(operator.Gte, field, value)
+}
+
+// Lt requires the field to be less than the value.
+func Lt(field string, value value.Value) Constraint {
+	return compare(operator.Lt, field, value)
+}
+
+// Lte requires the field to be less than or equal to the value.
+func Lte(field string, value value.Value) Constraint {
+	return compare(operator.Lte, field, value)
+}
+
+// Between requires the field to be within the lower and upper values,
+// inclusive.
+func Between(field string, lower, upper value.Value) Constraint {
+	return Constraint{
+		Operator: operator.Between,
+		Field:    &field,
+		Value:    &lower,
+		Upper:    &upper,
+	}
+}
+
+func compare(op, field string, value value.Value) Constraint {
+	return Constraint{
+		Operator: op,
+		Field:    &field,
+		Value:    &value,
+	}
+}
+
 func (q Query) And(c ...Constraint) Query {
-	q.Const(And(c...))
-	return q
+	return q.Const(And(c...))
+}
+
+func (q Query) Or(c ...Constraint) Query {
+	return q.Const(Or(c...))
+}
+
+func (q Query) Not(c Constraint) Query {
+	return q.Const(Not(c))
 }
 
 // And requires that all given constraints are succeed.
@@ -72,3 +201,26 @@ func And(c ...Constraint) Constraint {
 		SubConstraints: c,
 	}
 }
+
+// Or requires that any of the given constraints succeed.
+//
+// As with And, if a single constraint is supplied only the single
+// constraint is returned.
+func Or(c ...Constraint) Constraint {
+	if len(c) == 1 {
+		return c[0]
+	}
+
+	return Constraint{
+		Operator:       operator.Or,
+		SubConstraints: c,
+	}
+}
+
+// Not requires that the given constraint fails.
+func Not(c Constraint) Constraint {
+	return Constraint{
+		Operator:       operator.Not,
+		SubConstraints: []Constraint{c},
+	}
+}
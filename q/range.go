@@ -0,0 +1,72 @@
+package q
+
+import (
+	"fmt"
+
+	"github.com/leeola/fixity/q/operator"
+	"github.com/leeola/fixity/value"
+)
+
+// Bound is a lower or upper bound of a range constraint.
+type Bound struct {
+	Value     value.Value
+	Inclusive bool
+}
+
+// IsRange reports whether the operator is a range operator, as supported
+// by RangeBounds.
+func IsRange(op string) bool {
+	switch op {
+	case operator.Gt, operator.Gte, operator.Lt, operator.Lte, operator.Between:
+		return true
+	default:
+		return false
+	}
+}
+
+// RangeBounds returns the bounds of a range constraint, with a nil bound
+// being unbounded.
+//
+// Both bounds of a Between constraint must be of the same value type, as
+// int values are compared numerically and string values lexically.
+func RangeBounds(c Constraint) (lower, upper *Bound, err error) {
+	if c.Field == nil || c.Value == nil {
+		return nil, nil, fmt.Errorf("field or value nil on %s op", c.Operator)
+	}
+
+	switch c.Operator {
+	case operator.Gt:
+		lower = &Bound{Value: *c.Value}
+	case operator.Gte:
+		lower = &Bound{Value: *c.Value, Inclusive: true}
+	case operator.Lt:
+		upper = &Bound{Value: *c.Value}
+	case operator.Lte:
+		upper = &Bound{Value: *c.Value, Inclusive: true}
+	case operator.Between:
+		if c.Upper == nil {
+			return nil, nil, fmt.Errorf("upper nil on between op")
+		}
+		if c.Value.Type != c.Upper.Type {
+			return nil, nil, fmt.Errorf("between op bounds of different types: %s and %s",
+				c.Value.Type, c.Upper.Type)
+		}
+		lower = &Bound{Value: *c.Value, Inclusive: true}
+		upper = &Bound{Value: *c.Upper, Inclusive: true}
+	default:
+		return nil, nil, fmt.Errorf("not a range operator: %q", c.Operator)
+	}
+
+	for _, b := range []*Bound{lower, upper} {
+		if b == nil {
+			continue
+		}
+		switch b.Value.Type {
+		case value.TypeInt, value.TypeString:
+		default:
+			return nil, nil, fmt.Errorf("unexpected value type: %s", b.Value.Type)
+		}
+	}
+
+	return lower, upper, nil
+}
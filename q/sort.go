@@ -0,0 +1,31 @@
+package q
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseSort parses comma separated sort keys, each field prefixed with "-"
+// to sort descending, or optionally "+" to sort ascending. Eg, "-fsize,name".
+func ParseSort(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		var desc bool
+		switch {
+		case strings.HasPrefix(field, "-"):
+			desc, field = true, field[1:]
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		}
+
+		if field == "" {
+			return nil, fmt.Errorf("empty sort field in %q", s)
+		}
+
+		keys = append(keys, SortKey{Field: field, Descending: desc})
+	}
+
+	return keys, nil
+}
@@ -4,6 +4,8 @@ import "io"
 
 type Reader interface {
 	io.Reader
+	io.Seeker
+	io.ReaderAt
 
 	Size() (int64, error)
 
@@ -1,41 +1,101 @@
 package blobreader
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 
 	"github.com/leeola/fixity"
 )
 
+const (
+	// PeekSize is the number of leading bytes peeked to identify a blob.
+	PeekSize = 512
+
+	// schemaKey is the json key of fixity.Schema.SchemaType.
+	schemaKey = "_fixitySchema"
+)
+
 // ReadCloser implements peek/buffer into a BlobType to identify the blob,
 // and then caches the result for repeated BlobType requests.
 type ReadCloser struct {
-	*bytes.Buffer
+	io.Reader
 	blobType fixity.BlobType
 }
 
+// BlobType identifies the blob by peeking only the leading bytes of the
+// reader, so blobs of any size can be identified without buffering them.
+//
+// Schemas written by Fixity always begin with the schema key, so a json
+// object which does not contain the schema key within the peeked bytes is
+// considered schemaless. Schemaless data can still begin with the schema
+// key by chance, so a blob which then fails to decode as its schema must be
+// treated as schemaless. The returned ReadCloser reads the entire blob,
+// including the peeked bytes.
 func BlobType(r io.Reader) (*ReadCloser, fixity.BlobType, error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, 0, fmt.Errorf("readall: %v", err)
-	}
+	br := bufio.NewReaderSize(r, PeekSize)
 
-	// TODO(leeola): determine if unmarshalling large blobs of non-json
-	// is inefficient compared to peeking the first byte. If first byte
-	// peeking is better, add it above this section.
+	b, err := br.Peek(PeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, 0, fmt.Errorf("peek: %v", err)
+	}
 
-	// if the data fails to unmarshal, consider it schemaless.
-	// the zero value of fixity.Schema.SchemaType == fixity.BlobTypeSchemaless
-	var schema fixity.Schema
-	_ = json.Unmarshal(b, &schema)
+	bt := sniff(b)
 
 	return &ReadCloser{
-		Buffer:   bytes.NewBuffer(b),
-		blobType: schema.SchemaType,
-	}, schema.SchemaType, nil
+		Reader:   br,
+		blobType: bt,
+	}, bt, nil
+}
+
+// sniff returns the schema type of the leading bytes of a blob.
+//
+// If the bytes are not a json object with an integer schema key, the
+// blob is considered schemaless. The zero value of
+// fixity.Schema.SchemaType == fixity.BlobTypeSchemaless
+func sniff(b []byte) fixity.BlobType {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fixity.BlobTypeSchemaless
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fixity.BlobTypeSchemaless
+		}
+
+		if key != schemaKey {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fixity.BlobTypeSchemaless
+			}
+			continue
+		}
+
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return fixity.BlobTypeSchemaless
+		}
+
+		n, ok := v.(json.Number)
+		if !ok {
+			return fixity.BlobTypeSchemaless
+		}
+
+		i, err := n.Int64()
+		if err != nil {
+			return fixity.BlobTypeSchemaless
+		}
+
+		return fixity.BlobType(i)
+	}
+
+	return fixity.BlobTypeSchemaless
 }
 
 func (rc *ReadCloser) BlobType() fixity.BlobType {
@@ -0,0 +1,46 @@
+package blobreader
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/leeola/fixity"
+)
+
+func TestBlobType(t *testing.T) {
+	tests := []struct {
+		Blob string
+		Want fixity.BlobType
+	}{
+		{"", fixity.BlobTypeSchemaless},
+		{"foo", fixity.BlobTypeSchemaless},
+		{`{"foo":"bar"}`, fixity.BlobTypeSchemaless},
+		{`{"_fixitySchema":"2"}`, fixity.BlobTypeSchemaless},
+		{`{"_fixitySchema":2,"size":3}`, fixity.BlobTypeData},
+		{` {"foo":{"bar":[1]}, "_fixitySchema":4}`, fixity.BlobTypeMutation},
+		// the schema key is beyond the peeked bytes.
+		{`{"foo":"` + strings.Repeat("a", PeekSize) + `","_fixitySchema":4}`, fixity.BlobTypeSchemaless},
+		// schemas are identified before the end of large blobs.
+		{`{"_fixitySchema":1,"parts":["` + strings.Repeat("a", PeekSize*4) + `"]}`, fixity.BlobTypeParts},
+	}
+
+	for _, test := range tests {
+		rc, bt, err := BlobType(strings.NewReader(test.Blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bt != test.Want || rc.BlobType() != test.Want {
+			t.Errorf("want:%s, got:%s", test.Want, bt)
+		}
+
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.Blob {
+			t.Errorf("want all blob bytes, got:%d of %d", len(b), len(test.Blob))
+		}
+	}
+}
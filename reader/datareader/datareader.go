@@ -1,151 +1,427 @@
 package datareader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sync"
 
 	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/blobstore"
 )
 
+// Reader reads the data of a DataSchema, implementing fixity.Reader.
+//
+// Parts are located by their recorded sizes, so Seek and ReadAt only read
+// the parts containing the requested bytes. Both the balanced tree and the
+// legacy linked parts layouts are supported, as are DataSchemas written
+// before part sizes were recorded, though the size of each skipped part
+// must then be stat'd or read.
+//
+// Read and Seek are not safe for concurrent use, though ReadAt may be
+// called concurrently, as per io.ReaderAt.
+//
+// Close must be called to stop the read-ahead of a Reader which is not
+// read to EOF.
 type Reader struct {
 	ctx     context.Context
 	bs      fixity.BlobReader
 	dataRef fixity.Ref
+	config  Config
 
-	partReadCloser          io.ReadCloser
-	parts                   []fixity.Ref
-	partsIndex, partsLength int
-	nextPartsRef            *fixity.Ref
+	// mu guards the loaded data and locator, shared by Read and ReadAt.
+	mu     sync.Mutex
+	loaded bool
+	data   fixity.DataSchema
+	loc    locator
 
-	data fixity.DataSchema
+	// the sequential Read state.
+	offset         int64
+	partReadCloser io.ReadCloser
+	part           part
+	partOffset     int64
+
+	// the read-ahead window of the sequential Read.
+	ahead       []*fetch
+	aheadCtx    context.Context
+	cancelAhead context.CancelFunc
+
+	// wholeParts reads every part to EOF, so that it is verified by
+	// verifyBlobReader even if only some of its bytes are read.
+	wholeParts bool
+}
+
+type Config struct {
+	// ReadAhead is the number of parts following the part being read that
+	// are fetched concurrently by Read, and buffered in memory.
+	//
+	// Zero disables read-ahead, fetching each part only once the previous
+	// part has been read.
+	ReadAhead int `json:"readAhead,omitempty"`
+
+	// Verify verifies the Size and Checksum of the data, returning an error
+	// at the end of the data if they do not match the read bytes. See
+	// VerifyReader.
+	Verify bool `json:"verify,omitempty"`
 }
 
-func New(ctx context.Context, bs fixity.BlobReader, ref fixity.Ref) (*Reader, error) {
+// locator locates the part containing an offset of the data.
+type locator interface {
+	// locate returns the part containing the offset, returning io.EOF if
+	// the offset is at or beyond the end of the parts.
+	locate(offset int64) (part, error)
+
+	// next returns the part following the given part, returning io.EOF
+	// if it is the last part. The offset of the returned part is only
+	// known if the sizes of the preceding parts are.
+	next(p part) (part, error)
+
+	// resolve records the size of the part, learned by reading it to EOF.
+	resolve(p part, size int64) error
+}
+
+type part struct {
+	ref    fixity.Ref
+	offset int64
+	// size is -1 if unknown.
+	size int64
+	// index is the index of the part within the linked layout.
+	index int
+}
+
+func New(ctx context.Context, bs fixity.BlobReader, ref fixity.Ref, c Config) (*Reader, error) {
+	if c.ReadAhead < 0 {
+		return nil, fmt.Errorf("negative readahead: %d", c.ReadAhead)
+	}
+
 	return &Reader{
 		ctx:     ctx,
 		bs:      bs,
 		dataRef: ref,
+		config:  c,
 	}, nil
 }
 
+// Open returns the Reader of the data, wrapped in a VerifyReader if the
+// config enables Verify.
+func Open(ctx context.Context, bs fixity.BlobReader, ref fixity.Ref, c Config) (fixity.Reader, error) {
+	r, err := New(ctx, bs, ref, c)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	if !c.Verify {
+		return r, nil
+	}
+
+	vr, err := NewVerifyReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("newverifyreader: %v", err)
+	}
+
+	return vr, nil
+}
+
+// dataStruct loads the DataSchema and the locator of its layout, if not
+// loaded.
+//
+// The caller must hold mu.
 func (r *Reader) dataStruct() error {
+	if r.loaded {
+		return nil
+	}
+
 	var data fixity.DataSchema
 	if err := blobstore.ReadAndUnmarshal(r.ctx, r.bs, r.dataRef, &data); err != nil {
 		return fmt.Errorf("readandunmarshal %q: %v", r.dataRef, err)
 	}
 
-	partsLength := len(data.PartsSchema.Parts)
-	if partsLength == 0 {
+	if len(data.PartsSchema.Parts) == 0 {
 		return fmt.Errorf("dataschema %q missing parts", r.dataRef)
 	}
 
-	r.parts = data.PartsSchema.Parts
-	r.nextPartsRef = data.MoreParts
-
-	firstPart := data.PartsSchema.Parts[0]
-	rc, err := r.bs.Read(r.ctx, firstPart)
-	if err != nil {
-		return fmt.Errorf("dataschema %q read: %v", r.dataRef, err)
+	if data.Height > 0 {
+		r.loc = &tree{
+			r:    r,
+			root: &node{ref: r.dataRef, parts: data.PartsSchema},
+			path: make([]*node, data.Height),
+		}
+	} else {
+		l := &linked{r: r}
+		l.appendParts(data.PartsSchema)
+		r.loc = l
 	}
 
-	r.partReadCloser = rc
-	r.partsIndex++
-	r.partsLength = partsLength
 	r.data = data
+	r.loaded = true
 
 	return nil
 }
 
-func (r *Reader) nextParts() error {
-	if r.nextPartsRef == nil {
-		return io.EOF
+// locate returns the part containing the offset.
+//
+// The caller must hold mu.
+func (r *Reader) locate(offset int64) (part, error) {
+	if err := r.dataStruct(); err != nil {
+		return part{}, fmt.Errorf("dataschema: %v", err)
 	}
 
-	var parts fixity.PartsSchema
-	if err := blobstore.ReadAndUnmarshal(r.ctx, r.bs, *r.nextPartsRef, &parts); err != nil {
-		return fmt.Errorf("readandunmarshal: %v", err)
-	}
+	return r.loc.locate(offset)
+}
+
+// verifyBlobs verifies every blob read by the reader by its ref. It must be
+// called before the reader is first read.
+func (r *Reader) verifyBlobs() {
+	r.bs = verifyBlobReader{BlobReader: r.bs}
+	r.wholeParts = true
+}
 
-	partsLength := len(parts.Parts)
-	if partsLength == 0 {
-		return fmt.Errorf("partschema %q missing parts", r.nextPartsRef)
+// partSize returns the size of a part without a recorded size.
+func (r *Reader) partSize(ref fixity.Ref) (int64, error) {
+	if s, ok := r.bs.(fixity.BlobStater); ok {
+		info, err := s.Stat(r.ctx, ref)
+		if err != nil {
+			return 0, fmt.Errorf("stat: %v", err)
+		}
+		return info.Size, nil
 	}
 
-	r.partsIndex = 0
-	r.partsLength = partsLength
-	r.parts = parts.Parts
-	r.nextPartsRef = parts.MoreParts
+	rc, err := r.bs.Read(r.ctx, ref)
+	if err != nil {
+		return 0, fmt.Errorf("read: %v", err)
+	}
+	defer rc.Close()
 
-	return nil
+	return io.Copy(ioutil.Discard, rc)
 }
 
-func (r *Reader) nextPart() error {
-	// close the previous part if we're trying to load
-	// the next part.
-	if err := r.partReadCloser.Close(); err != nil {
-		return fmt.Errorf("close part: %v", err)
+// openPart opens the part, skipping to the given offset within it.
+func (r *Reader) openPart(ref fixity.Ref, skip int64) (io.ReadCloser, error) {
+	if r.wholeParts {
+		b, err := r.readBlob(r.ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("readblob %q: %v", ref, err)
+		}
+		if skip > int64(len(b)) {
+			return nil, fmt.Errorf("skip %q: %d beyond part size %d", ref, skip, len(b))
+		}
+		return ioutil.NopCloser(bytes.NewReader(b[skip:])), nil
 	}
 
-	if r.partsIndex == r.partsLength {
-		err := r.nextParts()
-		if err == io.EOF {
-			return io.EOF
+	rc, err := r.bs.Read(r.ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %v", ref, err)
+	}
+
+	if skip == 0 {
+		return rc, nil
+	}
+
+	if s, ok := rc.(io.Seeker); ok {
+		if _, err := s.Seek(skip, io.SeekStart); err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("seek %q: %v", ref, err)
 		}
-		if err != nil {
-			return fmt.Errorf("nextparts: %v", err)
+		return rc, nil
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, rc, skip); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("skip %q: %v", ref, err)
+	}
+
+	return rc, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for {
+		if r.partReadCloser == nil {
+			if err := r.openOffset(); err != nil {
+				// no wrap helper err, io.EOF is returned as is.
+				return 0, err
+			}
+		}
+
+		n, err := r.partReadCloser.Read(p)
+		r.offset += int64(n)
+		r.partOffset += int64(n)
+
+		if err == io.EOF {
+			if err := r.closePart(true); err != nil {
+				return n, fmt.Errorf("closepart: %v", err)
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
 		}
+
+		return n, err
 	}
+}
 
-	ref := r.parts[r.partsIndex]
-	rc, err := r.bs.Read(r.ctx, ref)
+// openOffset opens the part containing the current offset.
+func (r *Reader) openOffset() error {
+	r.mu.Lock()
+	pt, err := r.locate(r.offset)
+	r.mu.Unlock()
+
+	if err == io.EOF {
+		r.stopAhead()
+		return io.EOF
+	}
 	if err != nil {
-		return fmt.Errorf("read %q: %v", ref, err)
+		return fmt.Errorf("locate: %v", err)
+	}
+
+	skip := r.offset - pt.offset
+
+	var rc io.ReadCloser
+	if r.config.ReadAhead > 0 {
+		rc, err = r.readAhead(pt, skip)
+	} else {
+		rc, err = r.openPart(pt.ref, skip)
+	}
+	if err != nil {
+		return fmt.Errorf("openpart: %v", err)
 	}
 
 	r.partReadCloser = rc
-	r.partsIndex++
+	r.part = pt
+	r.partOffset = skip
 
 	return nil
 }
 
-func (r *Reader) Read(p []byte) (int, error) {
+// closePart closes the current part, resolving its size if it was read to
+// EOF.
+func (r *Reader) closePart(eof bool) error {
 	if r.partReadCloser == nil {
-		if err := r.dataStruct(); err != nil {
-			return 0, fmt.Errorf("dataschema: %v", err)
+		return nil
+	}
+
+	err := r.partReadCloser.Close()
+	r.partReadCloser = nil
+	if err != nil {
+		return fmt.Errorf("close part: %v", err)
+	}
+
+	if !eof {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.loc.resolve(r.part, r.partOffset)
+}
+
+// Seek implements io.Seeker. Seeking relative to io.SeekEnd uses the Size
+// of the DataSchema.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		size, err := r.Size()
+		if err != nil {
+			return 0, fmt.Errorf("size: %v", err)
 		}
+		abs = size + offset
+	default:
+		return 0, errors.New("seek: invalid whence")
 	}
 
-	n, err := r.partReadCloser.Read(p)
-	if err == io.EOF {
-		err := r.nextPart()
+	if abs < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+
+	if abs != r.offset {
+		if err := r.closePart(false); err != nil {
+			return 0, fmt.Errorf("closepart: %v", err)
+		}
+		r.offset = abs
+	}
+
+	return abs, nil
+}
+
+// ReadAt implements io.ReaderAt, independent of the offset of Read.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("readat: negative offset")
+	}
+
+	var n int
+	for n < len(p) {
+		r.mu.Lock()
+		pt, err := r.locate(off)
+		r.mu.Unlock()
+
 		if err == io.EOF {
 			return n, io.EOF
 		}
 		if err != nil {
-			return 0, fmt.Errorf("nextpart: %v", err)
+			return n, fmt.Errorf("locate: %v", err)
+		}
+
+		skip := off - pt.offset
+		rc, err := r.openPart(pt.ref, skip)
+		if err != nil {
+			return n, fmt.Errorf("openpart: %v", err)
+		}
+
+		m, err := io.ReadFull(rc, p[n:])
+		rc.Close()
+		n += m
+		off += int64(m)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.mu.Lock()
+			err = r.loc.resolve(pt, skip+int64(m))
+			r.mu.Unlock()
+			if err != nil {
+				return n, fmt.Errorf("resolve: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			return n, fmt.Errorf("readfull %q: %v", pt.ref, err)
 		}
-		return n, nil
 	}
-	return n, err
+
+	return n, nil
+}
+
+// Close cancels the fetches of the read-ahead window and closes the part
+// being read.
+func (r *Reader) Close() error {
+	r.stopAhead()
+	return r.closePart(false)
 }
 
 func (r *Reader) Checksum() (string, error) {
-	if r.partReadCloser == nil {
-		if err := r.dataStruct(); err != nil {
-			return "", fmt.Errorf("dataschema: %v", err)
-		}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.dataStruct(); err != nil {
+		return "", fmt.Errorf("dataschema: %v", err)
 	}
 
 	return r.data.Checksum, nil
 }
 
 func (r *Reader) Size() (int64, error) {
-	if r.partReadCloser == nil {
-		if err := r.dataStruct(); err != nil {
-			return 0, fmt.Errorf("dataschema: %v", err)
-		}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.dataStruct(); err != nil {
+		return 0, fmt.Errorf("dataschema: %v", err)
 	}
 
 	return r.data.Size, nil
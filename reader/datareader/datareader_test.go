@@ -0,0 +1,405 @@
+package datareader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/util/wutil"
+)
+
+// writeData writes variable sized chunks in the tree layout, or in the
+// legacy linked layout.
+func writeData(t *testing.T, bs fixity.BlobWriter, chunks int, withSizes, linked bool) (fixity.Ref, []byte) {
+	ctx := context.Background()
+
+	var (
+		content bytes.Buffer
+		refs    []fixity.Ref
+		sizes   []int64
+	)
+	for i := 0; i < chunks; i++ {
+		c := []byte(fmt.Sprintf("%d:%s;", i, bytes.Repeat([]byte("x"), i%7)))
+		ref, err := bs.Write(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content.Write(c)
+		refs = append(refs, ref)
+		sizes = append(sizes, int64(len(c)))
+	}
+
+	if !withSizes {
+		sizes = nil
+	}
+
+	if linked {
+		return writeLinked(t, bs, refs, sizes, int64(content.Len())), content.Bytes()
+	}
+
+	written, data, err := wutil.WriteData(ctx, bs, refs, sizes, int64(content.Len()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks > 100 && data.Height == 0 {
+		t.Fatalf("want tree layout for %d chunks", chunks)
+	}
+
+	return written[len(written)-1], content.Bytes()
+}
+
+// writeLinked writes the legacy linked layout of 100 parts per page.
+func writeLinked(t *testing.T, bs fixity.BlobWriter, refs []fixity.Ref, sizes []int64, size int64) fixity.Ref {
+	ctx := context.Background()
+
+	var (
+		more  *fixity.Ref
+		start = (len(refs) - 1) / 100 * 100
+	)
+	for ; ; start -= 100 {
+		end := start + 100
+		if end > len(refs) {
+			end = len(refs)
+		}
+
+		parts := fixity.PartsSchema{
+			Schema: fixity.Schema{
+				SchemaType: fixity.BlobTypeParts,
+			},
+			Parts:     refs[start:end],
+			MoreParts: more,
+		}
+		if sizes != nil {
+			parts.Sizes = sizes[start:end]
+		}
+
+		if start == 0 {
+			parts.SchemaType = fixity.BlobTypeData
+			ref, err := wutil.MarshalAndWrite(ctx, bs, fixity.DataSchema{PartsSchema: parts, Size: size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ref
+		}
+
+		ref, err := wutil.MarshalAndWrite(ctx, bs, parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		more = &ref
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	tests := []struct {
+		Chunks            int
+		WithSizes, Linked bool
+	}{
+		{Chunks: 50, WithSizes: true},
+		{Chunks: 250, WithSizes: true},
+		{Chunks: 250},
+		{Chunks: 10500, WithSizes: true},
+		{Chunks: 250, WithSizes: true, Linked: true},
+		{Chunks: 250, Linked: true},
+	}
+
+	for _, test := range tests {
+		for _, readAhead := range []int{0, 4} {
+			name := fmt.Sprintf("chunks=%d,sizes=%t,linked=%t,readahead=%d",
+				test.Chunks, test.WithSizes, test.Linked, readAhead)
+			t.Run(name, func(t *testing.T) {
+				testReaderSeek(t, test.Chunks, test.WithSizes, test.Linked, Config{ReadAhead: readAhead})
+			})
+		}
+	}
+}
+
+func testReaderSeek(t *testing.T, chunks int, withSizes, linked bool, c Config) {
+	ctx := context.Background()
+	bs := memory.New()
+	ref, content := writeData(t, bs, chunks, withSizes, linked)
+
+	r, err := New(ctx, bs, ref, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("sequential read does not match content")
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		off := rnd.Int63n(int64(len(content)))
+		n := rnd.Intn(300) + 1
+		want := content[off:]
+		if len(want) > n {
+			want = want[:n]
+		}
+
+		// a fresh reader, to locate without previously resolved parts.
+		fresh, err := New(ctx, bs, ref, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rs := range []io.ReadSeeker{r, fresh} {
+			if _, err := rs.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(rs, got); err != nil {
+				t.Fatalf("seek %d readfull: %v", off, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("seek %d want:%q, got:%q", off, want, got)
+			}
+		}
+
+		got := make([]byte, n)
+		m, err := r.ReadAt(got, off)
+		if m < n && err != io.EOF {
+			t.Fatalf("readat %d short read without eof: %v", off, err)
+		}
+		if m == n && err != nil {
+			t.Fatalf("readat %d: %v", off, err)
+		}
+		if !bytes.Equal(got[:m], want) {
+			t.Fatalf("readat %d want:%q, got:%q", off, want, got[:m])
+		}
+	}
+
+	end, err := r.Seek(-5, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end != int64(len(content)-5) {
+		t.Fatalf("want end offset:%d, got:%d", len(content)-5, end)
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content[len(content)-5:]) {
+		t.Errorf("want tail:%q, got:%q", content[len(content)-5:], b)
+	}
+
+	if _, err := r.ReadAt(make([]byte, 1), int64(len(content))); err != io.EOF {
+		t.Errorf("want readat eof, got:%v", err)
+	}
+}
+
+// slowStore delays every read, as a high latency blobstore would.
+type slowStore struct {
+	*memory.Store
+	delay time.Duration
+}
+
+func (s slowStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Store.Read(ctx, ref)
+}
+
+func TestReadAhead(t *testing.T) {
+	bs := slowStore{Store: memory.New(), delay: 10 * time.Millisecond}
+	ref, content := writeData(t, bs.Store, 50, true, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := New(ctx, bs, ref, Config{ReadAhead: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("read does not match content")
+	}
+	// 50 sequential reads take at least 500ms.
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("want concurrent fetches, read took %s", d)
+	}
+
+	r, err = New(ctx, bs, ref, Config{ReadAhead: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Error("want error from cancelled context")
+	}
+
+	r, err = New(context.Background(), bs, ref, Config{ReadAhead: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	aheadCtx := r.aheadCtx
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if aheadCtx == nil || aheadCtx.Err() == nil {
+		t.Error("want read-ahead cancelled by close")
+	}
+}
+
+func TestVerifyReader(t *testing.T) {
+	ctx := context.Background()
+	bs := memory.New()
+
+	const content = "foobar"
+	// blake2b-256 of "foobar".
+	const checksum = "93a0e84a8cdd4166267dbe1263e937f08087723ac24e7dcc35b3d5941775ef47"
+
+	var refs []fixity.Ref
+	for _, c := range []string{"foo", "bar"} {
+		ref, err := bs.Write(ctx, []byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	tests := []struct {
+		Size     int64
+		Checksum string
+		Corrupt  bool
+	}{
+		{Size: 6, Checksum: checksum},
+		{Size: 7, Checksum: checksum, Corrupt: true},
+		{Size: 6, Checksum: "beef", Corrupt: true},
+	}
+
+	for _, test := range tests {
+		written, _, err := wutil.WriteData(ctx, bs, refs, []int64{3, 3}, test.Size, test.Checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := Open(ctx, bs, written[len(written)-1], Config{Verify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if string(b) != content {
+			t.Errorf("want:%q, got:%q", content, b)
+		}
+
+		_, corrupt := err.(*CorruptDataError)
+		if corrupt != test.Corrupt {
+			t.Errorf("size:%d checksum:%s want corrupt:%t, got:%v", test.Size, test.Checksum, test.Corrupt, err)
+		}
+
+		// the checksum of reads not from the start is not verified.
+		if _, err := r.Seek(3, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Errorf("want partial read, got:%v", err)
+		}
+	}
+}
+
+// corruptStore returns the given bytes in place of the blobs of the refs.
+type corruptStore struct {
+	*memory.Store
+	blobs map[fixity.Ref][]byte
+}
+
+func (s corruptStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	if b, ok := s.blobs[ref]; ok {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return s.Store.Read(ctx, ref)
+}
+
+func TestVerifyReaderParts(t *testing.T) {
+	ctx := context.Background()
+	ms := memory.New()
+
+	var refs []fixity.Ref
+	for _, c := range []string{"foo", "bar"} {
+		ref, err := ms.Write(ctx, []byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	written, _, err := wutil.WriteData(ctx, ms, refs, []int64{3, 3}, 6, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataRef := written[len(written)-1]
+
+	bs := corruptStore{Store: ms, blobs: map[fixity.Ref][]byte{refs[1]: []byte("baz")}}
+
+	for _, readAhead := range []int{0, 2} {
+		r, err := Open(ctx, bs, dataRef, Config{Verify: true, ReadAhead: readAhead})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.Seek(4, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil || !strings.Contains(err.Error(), "corrupt blob") {
+			t.Errorf("readahead %d want corrupt blob err from seek and read, got:%v", readAhead, err)
+		}
+
+		if _, err := r.ReadAt(make([]byte, 1), 4); err == nil || !strings.Contains(err.Error(), "corrupt blob") {
+			t.Errorf("readahead %d want corrupt blob err from readat, got:%v", readAhead, err)
+		}
+
+		b := make([]byte, 2)
+		if _, err := r.ReadAt(b, 1); err != nil || string(b) != "oo" {
+			t.Errorf("readahead %d want:oo, got:%q, %v", readAhead, b, err)
+		}
+	}
+
+	// the parts of other readers cannot be verified.
+	dr, err := New(ctx, bs, dataRef, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vr, err := NewVerifyReader(struct{ fixity.Reader }{dr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vr.ReadAt(make([]byte, 1), 4); err != ErrUnverified {
+		t.Errorf("want err:%q from readat, got:%v", ErrUnverified, err)
+	}
+	if _, err := vr.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vr.Read(make([]byte, 1)); err != ErrUnverified {
+		t.Errorf("want err:%q from read after seek, got:%v", ErrUnverified, err)
+	}
+}
@@ -0,0 +1,130 @@
+package datareader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+)
+
+// linked locates parts of the legacy linked layout, loading the linked
+// PartsSchemas as they are needed.
+type linked struct {
+	r *Reader
+
+	parts        []part
+	nextPartsRef *fixity.Ref
+
+	// resolved is the number of leading parts with known sizes and offsets,
+	// and resolvedEnd is the offset after the last resolved part.
+	resolved    int
+	resolvedEnd int64
+}
+
+func (l *linked) appendParts(ps fixity.PartsSchema) {
+	for i, ref := range ps.Parts {
+		size := int64(-1)
+		if len(ps.Sizes) == len(ps.Parts) {
+			size = ps.Sizes[i]
+		}
+		l.parts = append(l.parts, part{ref: ref, size: size, index: len(l.parts)})
+	}
+	l.nextPartsRef = ps.MoreParts
+}
+
+// nextParts loads the next linked PartsSchema, returning io.EOF if there
+// are no more parts.
+func (l *linked) nextParts() error {
+	if l.nextPartsRef == nil {
+		return io.EOF
+	}
+
+	ref := *l.nextPartsRef
+
+	var parts fixity.PartsSchema
+	if err := blobstore.ReadAndUnmarshal(l.r.ctx, l.r.bs, ref, &parts); err != nil {
+		return fmt.Errorf("readandunmarshal: %v", err)
+	}
+
+	if len(parts.Parts) == 0 {
+		return fmt.Errorf("partschema %q missing parts", ref)
+	}
+
+	l.appendParts(parts)
+
+	return nil
+}
+
+func (l *linked) locate(offset int64) (part, error) {
+	if offset < l.resolvedEnd {
+		i := sort.Search(l.resolved, func(i int) bool {
+			return l.parts[i].offset+l.parts[i].size > offset
+		})
+		return l.parts[i], nil
+	}
+
+	for {
+		i := l.resolved
+		if i == len(l.parts) {
+			err := l.nextParts()
+			if err == io.EOF {
+				return part{}, io.EOF
+			}
+			if err != nil {
+				return part{}, fmt.Errorf("nextparts: %v", err)
+			}
+		}
+
+		p := &l.parts[i]
+		p.offset = l.resolvedEnd
+
+		// a sequential read does not need the size of the next part, it
+		// is learned when the part is read to EOF.
+		if offset == p.offset && p.size != 0 {
+			return *p, nil
+		}
+
+		if p.size < 0 {
+			size, err := l.r.partSize(p.ref)
+			if err != nil {
+				return part{}, fmt.Errorf("partsize %q: %v", p.ref, err)
+			}
+			p.size = size
+		}
+
+		l.resolved++
+		l.resolvedEnd += p.size
+
+		if offset < l.resolvedEnd {
+			return *p, nil
+		}
+	}
+}
+
+func (l *linked) next(p part) (part, error) {
+	i := p.index + 1
+	for i >= len(l.parts) {
+		if err := l.nextParts(); err != nil {
+			return part{}, err // no wrap helper err, io.EOF is returned as is.
+		}
+	}
+
+	return l.parts[i], nil
+}
+
+func (l *linked) resolve(pt part, size int64) error {
+	p := &l.parts[pt.index]
+	if p.size >= 0 && p.size != size {
+		return fmt.Errorf("part %q size %d does not match recorded size %d", p.ref, size, p.size)
+	}
+	p.size = size
+
+	if pt.index == l.resolved {
+		l.resolved++
+		l.resolvedEnd += size
+	}
+
+	return nil
+}
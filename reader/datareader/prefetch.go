@@ -0,0 +1,124 @@
+package datareader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/leeola/fixity"
+)
+
+// fetch is a part being fetched by the read-ahead window.
+type fetch struct {
+	part part
+	done chan struct{}
+	b    []byte
+	err  error
+}
+
+// readAhead returns the part from the read-ahead window, and fetches the
+// parts following it to fill the window.
+func (r *Reader) readAhead(pt part, skip int64) (io.ReadCloser, error) {
+	// fetches are matched by ref, as the bytes of equal refs are equal.
+	// Parts before the matching part were seeked past.
+	match := -1
+	for i, f := range r.ahead {
+		if f.part.ref == pt.ref {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		r.stopAhead()
+		r.startFetch(pt)
+		match = 0
+	}
+
+	f := r.ahead[match]
+	r.ahead = r.ahead[match+1:]
+	r.fillAhead(pt)
+
+	select {
+	case <-f.done:
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	}
+
+	if f.err != nil {
+		return nil, fmt.Errorf("fetch %q: %v", pt.ref, f.err)
+	}
+
+	if skip > int64(len(f.b)) {
+		return nil, fmt.Errorf("skip %q: %d beyond part size %d", pt.ref, skip, len(f.b))
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(f.b[skip:])), nil
+}
+
+// fillAhead fetches the parts following the given part, or following the
+// last part in the window, until the window is full.
+//
+// Errors locating the following parts are ignored, they are returned by
+// Read once it reaches the part.
+func (r *Reader) fillAhead(pt part) {
+	last := pt
+	if len(r.ahead) > 0 {
+		last = r.ahead[len(r.ahead)-1].part
+	}
+
+	for len(r.ahead) < r.config.ReadAhead {
+		r.mu.Lock()
+		next, err := r.loc.next(last)
+		r.mu.Unlock()
+		if err != nil {
+			return
+		}
+
+		r.startFetch(next)
+		last = next
+	}
+}
+
+func (r *Reader) startFetch(pt part) {
+	if r.aheadCtx == nil {
+		r.aheadCtx, r.cancelAhead = context.WithCancel(r.ctx)
+	}
+
+	f := &fetch{
+		part: pt,
+		done: make(chan struct{}),
+	}
+	r.ahead = append(r.ahead, f)
+
+	go func(ctx context.Context) {
+		defer close(f.done)
+		f.b, f.err = r.readBlob(ctx, pt.ref)
+	}(r.aheadCtx)
+}
+
+func (r *Reader) readBlob(ctx context.Context, ref fixity.Ref) ([]byte, error) {
+	rc, err := r.bs.Read(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("read: %v", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("readall: %v", err)
+	}
+
+	return b, nil
+}
+
+// stopAhead cancels all fetches of the read-ahead window.
+func (r *Reader) stopAhead() {
+	if r.cancelAhead != nil {
+		r.cancelAhead()
+	}
+	r.ahead = nil
+	r.aheadCtx = nil
+	r.cancelAhead = nil
+}
@@ -0,0 +1,151 @@
+package datareader
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+)
+
+// tree locates parts of the balanced tree layout, descending from the root
+// by the subtree sizes.
+//
+// Only the most recently located node of each height is kept, so memory is
+// bounded by the height of the tree while sequential reads rarely load a
+// node twice.
+type tree struct {
+	r    *Reader
+	root *node
+
+	// path is the most recently located node of each height, below the
+	// root.
+	path []*node
+}
+
+type node struct {
+	ref   fixity.Ref
+	parts fixity.PartsSchema
+
+	// sizes are the subtree sizes, computed if not recorded.
+	sizes []int64
+}
+
+func (t *tree) locate(offset int64) (part, error) {
+	n := t.root
+	var start int64
+	for {
+		sizes, err := t.sizes(n)
+		if err != nil {
+			return part{}, fmt.Errorf("sizes %q: %v", n.ref, err)
+		}
+
+		i := -1
+		for j, size := range sizes {
+			if offset < start+size {
+				i = j
+				break
+			}
+			start += size
+		}
+		if i < 0 {
+			return part{}, io.EOF
+		}
+
+		ref := n.parts.Parts[i]
+		if n.parts.Height == 0 {
+			return part{ref: ref, offset: start, size: sizes[i]}, nil
+		}
+
+		n, err = t.node(ref, n.parts.Height-1)
+		if err != nil {
+			return part{}, fmt.Errorf("node %q: %v", ref, err)
+		}
+	}
+}
+
+func (t *tree) next(p part) (part, error) {
+	return t.locate(p.offset + p.size)
+}
+
+func (t *tree) resolve(p part, size int64) error {
+	if p.size != size {
+		return fmt.Errorf("part %q size %d does not match recorded size %d", p.ref, size, p.size)
+	}
+	return nil
+}
+
+// node returns the node of the given height, loading it if it is not the
+// cached node of that height.
+func (t *tree) node(ref fixity.Ref, height int) (*node, error) {
+	if n := t.path[height]; n != nil && n.ref == ref {
+		return n, nil
+	}
+
+	parts, err := t.loadParts(ref, height)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	n := &node{ref: ref, parts: parts}
+	t.path[height] = n
+	return n, nil
+}
+
+func (t *tree) loadParts(ref fixity.Ref, height int) (fixity.PartsSchema, error) {
+	var parts fixity.PartsSchema
+	if err := blobstore.ReadAndUnmarshal(t.r.ctx, t.r.bs, ref, &parts); err != nil {
+		return fixity.PartsSchema{}, fmt.Errorf("readandunmarshal: %v", err)
+	}
+
+	if len(parts.Parts) == 0 {
+		return fixity.PartsSchema{}, fmt.Errorf("partschema %q missing parts", ref)
+	}
+
+	if parts.Height != height {
+		return fixity.PartsSchema{}, fmt.Errorf("partschema %q height %d, want %d", ref, parts.Height, height)
+	}
+
+	return parts, nil
+}
+
+// sizes returns the subtree sizes of the node. If the sizes were not
+// recorded, the entire subtree is walked to compute them.
+func (t *tree) sizes(n *node) ([]int64, error) {
+	if n.sizes != nil {
+		return n.sizes, nil
+	}
+
+	if len(n.parts.Sizes) == len(n.parts.Parts) {
+		n.sizes = n.parts.Sizes
+		return n.sizes, nil
+	}
+
+	sizes := make([]int64, len(n.parts.Parts))
+	for i, ref := range n.parts.Parts {
+		if n.parts.Height == 0 {
+			size, err := t.r.partSize(ref)
+			if err != nil {
+				return nil, fmt.Errorf("partsize %q: %v", ref, err)
+			}
+			sizes[i] = size
+			continue
+		}
+
+		parts, err := t.loadParts(ref, n.parts.Height-1)
+		if err != nil {
+			return nil, err // no wrap helper err
+		}
+
+		childSizes, err := t.sizes(&node{ref: ref, parts: parts})
+		if err != nil {
+			return nil, err // no wrap recursive err
+		}
+		for _, size := range childSizes {
+			sizes[i] += size
+		}
+	}
+
+	n.sizes = sizes
+	return sizes, nil
+}
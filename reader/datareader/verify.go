@@ -0,0 +1,178 @@
+package datareader
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/leeola/fixity"
+)
+
+// CorruptDataError is returned at the end of a verified data read when the
+// read bytes do not match the Size or Checksum of the DataSchema.
+type CorruptDataError struct {
+	Msg string
+}
+
+func (e *CorruptDataError) Error() string {
+	return "corrupt data: " + e.Msg
+}
+
+// ErrUnverified is returned by a VerifyReader for reads which cannot be
+// verified.
+var ErrUnverified = errors.New("read cannot be verified")
+
+// VerifyReader hashes and counts the bytes read from the underlying
+// reader, returning a *CorruptDataError instead of io.EOF if they do not
+// match the Size and Checksum of the reader.
+//
+// Size and Checksum are only verified for data read sequentially from the
+// start. If the reader is a *Reader, every part is also verified by its
+// ref, so that reads after a Seek and ReadAt are verified. Otherwise ReadAt,
+// and Read after seeking anywhere but the start, return ErrUnverified.
+type VerifyReader struct {
+	fixity.Reader
+
+	hasher   hash.Hash
+	size     int64
+	disabled bool
+	// parts is true if the parts of the reader are verified.
+	parts bool
+}
+
+// NewVerifyReader returns a VerifyReader of the given reader. The checksum
+// is computed with the hash of the DataSchema ref if the reader is a
+// *Reader, and with the default hash otherwise.
+//
+// A *Reader must not have been read before, as it is changed to verify
+// every blob it reads.
+func NewVerifyReader(r fixity.Reader) (*VerifyReader, error) {
+	hashName := fixity.DefaultMultihashName
+	dr, parts := r.(*Reader)
+	if parts {
+		name, err := dr.dataRef.HashName()
+		if err != nil {
+			return nil, fmt.Errorf("hashname: %v", err)
+		}
+		hashName = name
+		dr.verifyBlobs()
+	}
+
+	hasher, err := fixity.Hasher(hashName)
+	if err != nil {
+		return nil, fmt.Errorf("hasher: %v", err)
+	}
+
+	return &VerifyReader{
+		Reader: r,
+		hasher: hasher,
+		parts:  parts,
+	}, nil
+}
+
+func (r *VerifyReader) Read(p []byte) (int, error) {
+	if r.disabled && !r.parts {
+		return 0, ErrUnverified
+	}
+
+	n, err := r.Reader.Read(p)
+	if r.disabled {
+		return n, err
+	}
+
+	// hash.Hash never returns an error.
+	r.hasher.Write(p[:n])
+	r.size += int64(n)
+
+	if err == io.EOF {
+		if verr := r.verify(); verr != nil {
+			return n, verr
+		}
+	}
+
+	return n, err
+}
+
+func (r *VerifyReader) verify() error {
+	size, err := r.Reader.Size()
+	if err != nil {
+		return fmt.Errorf("size: %v", err)
+	}
+
+	if r.size != size {
+		return &CorruptDataError{
+			Msg: fmt.Sprintf("read size %d does not match dataschema size %d", r.size, size),
+		}
+	}
+
+	want, err := r.Reader.Checksum()
+	if err != nil {
+		return fmt.Errorf("checksum: %v", err)
+	}
+
+	if got := hex.EncodeToString(r.hasher.Sum(nil)); got != want {
+		return &CorruptDataError{
+			Msg: fmt.Sprintf("read checksum %s does not match dataschema checksum %s", got, want),
+		}
+	}
+
+	return nil
+}
+
+func (r *VerifyReader) Seek(offset int64, whence int) (int64, error) {
+	abs, err := r.Reader.Seek(offset, whence)
+	if err != nil {
+		return abs, err // no wrap, the wrapped reader is the caller's
+	}
+
+	// a seek to the current offset does not affect verification.
+	if abs == r.size && !r.disabled {
+		return abs, nil
+	}
+
+	r.hasher.Reset()
+	r.size = 0
+	r.disabled = abs != 0
+
+	return abs, nil
+}
+
+// ReadAt implements io.ReaderAt, returning ErrUnverified if the parts of
+// the reader are not verified.
+func (r *VerifyReader) ReadAt(p []byte, off int64) (int, error) {
+	if !r.parts {
+		return 0, ErrUnverified
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+// Close closes the underlying reader, if it is an io.Closer.
+func (r *VerifyReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// verifyBlobReader verifies every read blob by its ref.
+type verifyBlobReader struct {
+	fixity.BlobReader
+}
+
+func (bs verifyBlobReader) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	rc, err := bs.BlobReader.Read(ctx, ref)
+	if err != nil {
+		return nil, err // no wrap, the blobstore is the caller's
+	}
+
+	vr, err := fixity.NewVerifyReader(ref, rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("newverifyreader: %v", err)
+	}
+
+	return vr, nil
+}
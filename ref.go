@@ -28,3 +28,21 @@ func (r Ref) HashName() (string, error) {
 
 	return decoded.Name, nil
 }
+
+// Digest returns the hash digest of the ref, without the multihash
+// identification prefix.
+//
+// The digest is comparable to the sum of the Hasher of the ref HashName.
+func (r Ref) Digest() ([]byte, error) {
+	mh, err := multihash.FromB58String(string(r))
+	if err != nil {
+		return nil, fmt.Errorf("fromb58string: %v", err)
+	}
+
+	decoded, err := multihash.Decode(mh)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %v", err)
+	}
+
+	return decoded.Digest, nil
+}
@@ -25,10 +25,30 @@ type DataSchema struct {
 	Checksum string `json:"checksum"`
 }
 
+// PartsSchema lists the parts of data, either as a node of a balanced tree
+// or as a page of the legacy linked layout.
+//
+// In the tree layout a PartsSchema with a Height of zero is a leaf listing
+// chunks, and a PartsSchema with a Height of N lists PartsSchemas with a
+// Height of N-1. The tree layout never uses MoreParts.
+//
+// In the legacy linked layout Parts are always chunks, and the remaining
+// chunks are listed by the linked MoreParts.
 type PartsSchema struct {
 	Schema
-	Parts     []Ref `json:"parts"`
-	MoreParts *Ref  `json:"moreParts,omitempty"`
+	Parts []Ref `json:"parts"`
+
+	// Sizes are the byte sizes of each part, in the order of Parts. In the
+	// tree layout each size is the total size of the subtree.
+	//
+	// Sizes allow readers to seek without reading the parts, and are
+	// missing from schemas written before they were recorded.
+	Sizes []int64 `json:"sizes,omitempty"`
+
+	// Height is the height of this node in the tree layout.
+	Height int `json:"height,omitempty"`
+
+	MoreParts *Ref `json:"moreParts,omitempty"`
 }
 
 type ValuesSchema struct {
@@ -3,6 +3,7 @@ package fixity
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type Store interface {
@@ -13,3 +14,28 @@ type Store interface {
 	WriteNamespace(ctx context.Context, id, namespace string, v Values, r io.Reader) ([]Ref, error)
 	Querier
 }
+
+// HistoryReader is an optional Store interface, returning the mutation
+// refs of an id, starting with the current mutation and following
+// Mutation.Previous back to the first.
+type HistoryReader interface {
+	History(ctx context.Context, id string) ([]Ref, error)
+}
+
+// OptionsWriter is an optional Store interface, writing with WriteOptions.
+type OptionsWriter interface {
+	WriteWithOptions(ctx context.Context, id string, v Values, r io.Reader, o WriteOptions) ([]Ref, error)
+}
+
+// WriteOptions are per write overrides of the Store config.
+type WriteOptions struct {
+	// Namespace of the mutation, the user namespace if empty.
+	Namespace string
+
+	// Time of the mutation, the current time if zero.
+	Time time.Time
+
+	// AverageChunkSize overrides the average chunk size of the chunker of
+	// the Store. Chunker type specific sizes are ignored when overridden.
+	AverageChunkSize int
+}
@@ -0,0 +1,367 @@
+// Package base implements the Fixity Store shared by the store
+// implementations, which differ only in how mutations are signed when
+// written and verified when read.
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/config"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/index/reindex"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/reader/datareader"
+	"github.com/leeola/fixity/util/wutil"
+	"github.com/leeola/fixity/value"
+)
+
+// Hook signs mutations before they are written and verifies mutations
+// after they are read.
+type Hook interface {
+	// Sign returns the mutation to write in place of m.
+	Sign(m fixity.Mutation) (fixity.Mutation, error)
+
+	// Verify returns an error if the read mutation must not be trusted.
+	// Verify is called for every read mutation, including the current
+	// version of an id before it is linked as the previous version of a
+	// write.
+	Verify(ctx context.Context, m fixity.Mutation) error
+}
+
+type Config struct {
+	Blobstore fixity.Blobstore
+	Index     fixity.Index
+
+	// Config of the data readers, such as the read-ahead window.
+	ReadConfig datareader.Config
+
+	Chunker config.ChunkerConfig
+
+	// Hook is optional, mutations are neither signed nor verified if nil.
+	Hook Hook
+}
+
+type Store struct {
+	// embedded because the store exposes the same methods.
+	index.Querier
+
+	bstor      fixity.Blobstore
+	index      index.Indexer
+	readConfig datareader.Config
+	chunker    config.ChunkerConfig
+	hook       Hook
+}
+
+// ConfigFrom returns the Config of the named store, with the given
+// blobstore and index constructed from the fixity config.
+func ConfigFrom(name string, fc config.Config, blobstoreName, indexName string) (Config, error) {
+	bs, err := fixity.NewBlobstoreFromConfig(blobstoreName, fc)
+	if err != nil {
+		return Config{}, fmt.Errorf("blobstoreFromConfig: %v", err)
+	}
+
+	ix, err := fixity.NewIndexFromConfig(indexName, fc)
+	if err != nil {
+		return Config{}, fmt.Errorf("indexFromConfig: %v", err)
+	}
+
+	var chunker config.ChunkerConfig
+	if tc := fc.StoreConfigs[name]; tc.Chunker != nil {
+		chunker = *tc.Chunker
+	}
+
+	return Config{
+		Blobstore: bs,
+		Index:     ix,
+		Chunker:   chunker,
+	}, nil
+}
+
+func New(c Config) *Store {
+	return &Store{
+		Querier:    c.Index,
+		bstor:      c.Blobstore,
+		index:      c.Index,
+		readConfig: c.ReadConfig,
+		chunker:    c.Chunker,
+		hook:       c.Hook,
+	}
+}
+
+func (s *Store) Write(ctx context.Context, id string, v fixity.Values, r io.Reader) ([]fixity.Ref, error) {
+	// default to user namespace, ie ""
+	return s.WriteNamespace(ctx, id, "", v, r)
+}
+
+func (s *Store) WriteNamespace(ctx context.Context, id, namespace string, v fixity.Values, r io.Reader) ([]fixity.Ref, error) {
+	return s.WriteWithOptions(ctx, id, v, r, fixity.WriteOptions{Namespace: namespace})
+}
+
+func (s *Store) WriteTimeNamespace(ctx context.Context,
+	t time.Time, id, namespace string, v fixity.Values, r io.Reader) ([]fixity.Ref, error) {
+
+	return s.WriteWithOptions(ctx, id, v, r, fixity.WriteOptions{Namespace: namespace, Time: t})
+}
+
+// WriteWithOptions implements fixity.OptionsWriter.
+func (s *Store) WriteWithOptions(ctx context.Context, id string,
+	v fixity.Values, r io.Reader, o fixity.WriteOptions) ([]fixity.Ref, error) {
+
+	if v == nil && r == nil {
+		return nil, errors.New("values and data cannot be nil")
+	}
+
+	t := o.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	previous, _, err := s.head(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("head: %v", err)
+	}
+
+	var refs []fixity.Ref
+
+	var (
+		data    *fixity.DataSchema
+		dataRef fixity.Ref
+	)
+	if r != nil {
+		cc := s.chunker
+		if o.AverageChunkSize > 0 {
+			cc.AverageSize = o.AverageChunkSize
+			cc.Config = nil
+		}
+
+		cHashes, d, err := wutil.WriteReader(ctx, s.bstor, r, cc)
+		if err != nil {
+			return nil, fmt.Errorf("writereader: %v", err)
+		}
+		data = d
+		dataRef = cHashes[len(cHashes)-1]
+		refs = cHashes
+	}
+
+	var valuesRef fixity.Ref
+	if v != nil {
+		ref, err := wutil.WriteValues(ctx, s.bstor, v)
+		if err != nil {
+			return nil, fmt.Errorf("writecontent: %v", err)
+		}
+		valuesRef = ref
+		refs = append(refs, ref)
+	}
+
+	mutation := fixity.Mutation{
+		Schema: fixity.Schema{
+			SchemaType: fixity.BlobTypeMutation,
+		},
+		ID:           id,
+		Namespace:    o.Namespace,
+		Time:         t,
+		DataSchema:   dataRef,
+		ValuesSchema: valuesRef,
+		Previous:     previous,
+	}
+
+	if s.hook != nil {
+		mutation, err = s.hook.Sign(mutation)
+		if err != nil {
+			return nil, fmt.Errorf("sign: %v", err)
+		}
+	}
+
+	ref, err := wutil.MarshalAndWrite(ctx, s.bstor, mutation)
+	if err != nil {
+		return nil, fmt.Errorf("marshalandwrite mutation: %v", err)
+	}
+
+	if err := s.index.Index(ref, mutation, data, v); err != nil {
+		return nil, fmt.Errorf("index: %v", err)
+	}
+
+	return append(refs, ref), nil
+}
+
+func (s *Store) Blob(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	rc, err := s.bstor.Read(ctx, ref)
+	if err != nil {
+		// not wrapping to let error values fall through. The error context
+		// from this store is likely meaningless here.
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+func (s *Store) Read(ctx context.Context, id string) (
+	fixity.Mutation, fixity.Values, fixity.Reader, error) {
+
+	ref, m, err := s.head(ctx, id)
+	if err != nil {
+		return fixity.Mutation{}, nil, nil, err // no wrap helper err
+	}
+
+	if ref == "" {
+		return fixity.Mutation{}, nil, nil, fmt.Errorf("id not found")
+	}
+
+	return s.readMutation(ctx, m)
+}
+
+// head returns the ref and verified mutation of the current version of the
+// given id, or an empty ref if the id does not exist.
+//
+// The index is not trusted, so that a mutation written to the blobstore
+// and indexed without the hook is neither read nor linked as the previous
+// version of a write.
+func (s *Store) head(ctx context.Context, id string) (fixity.Ref, fixity.Mutation, error) {
+	matches, err := s.Query(q.New().Eq(index.FIDKey, value.String(id)))
+	if err != nil {
+		return "", fixity.Mutation{}, fmt.Errorf("query id: %v", err)
+	}
+
+	matchesLen := len(matches)
+	tooManyMatches := matchesLen > 1
+	noMatches := matchesLen == 0
+
+	if tooManyMatches {
+		return "", fixity.Mutation{}, fmt.Errorf("id matched more than once")
+	}
+
+	if noMatches {
+		return "", fixity.Mutation{}, nil
+	}
+
+	ref := matches[0].Ref
+	m, err := s.verifiedMutation(ctx, ref)
+	if err != nil {
+		return "", fixity.Mutation{}, err // no wrap helper err
+	}
+
+	if m.ID != id {
+		return "", fixity.Mutation{}, fmt.Errorf("head %q is not a mutation of id %q", ref, id)
+	}
+
+	return ref, m, nil
+}
+
+// QueryPage implements fixity.PageQuerier with the index of the store.
+func (s *Store) QueryPage(qu q.Query) (fixity.Page, error) {
+	return fixity.QueryPage(s.Querier, qu)
+}
+
+// History implements fixity.HistoryReader.
+func (s *Store) History(ctx context.Context, id string) ([]fixity.Ref, error) {
+	ref, m, err := s.head(ctx, id)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	if ref == "" {
+		return nil, fmt.Errorf("id not found")
+	}
+
+	refs := []fixity.Ref{ref}
+	for m.Previous != "" {
+		ref = m.Previous
+		m, err = s.verifiedMutation(ctx, ref)
+		if err != nil {
+			return nil, err // no wrap helper err
+		}
+
+		if m.ID != id {
+			return nil, fmt.Errorf("previous %q is not a mutation of id %q", ref, id)
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+func (s *Store) ReadRef(ctx context.Context, ref fixity.Ref) (
+	fixity.Mutation, fixity.Values, fixity.Reader, error) {
+
+	mutation, err := s.verifiedMutation(ctx, ref)
+	if err != nil {
+		return fixity.Mutation{}, nil, nil, err // no wrap helper err
+	}
+
+	return s.readMutation(ctx, mutation)
+}
+
+// verifiedMutation reads the mutation of the ref, returning an error if it
+// is not a mutation or fails verification by the hook.
+func (s *Store) verifiedMutation(ctx context.Context, ref fixity.Ref) (fixity.Mutation, error) {
+	var m fixity.Mutation
+	if err := blobstore.ReadAndUnmarshal(ctx, s.bstor, ref, &m); err != nil {
+		return fixity.Mutation{}, fmt.Errorf("read mutation %q: %v", ref, err)
+	}
+
+	if m.SchemaType != fixity.BlobTypeMutation {
+		return fixity.Mutation{}, fmt.Errorf("%q is not a mutation", ref)
+	}
+
+	if err := s.verify(ctx, m); err != nil {
+		return fixity.Mutation{}, fmt.Errorf("mutation %q: %v", ref, err)
+	}
+
+	return m, nil
+}
+
+// readMutation returns the values and data reader of the verified
+// mutation.
+func (s *Store) readMutation(ctx context.Context, mutation fixity.Mutation) (
+	fixity.Mutation, fixity.Values, fixity.Reader, error) {
+
+	var values fixity.ValuesSchema
+	if mutation.ValuesSchema != "" {
+		if err := blobstore.ReadAndUnmarshal(ctx, s.bstor, mutation.ValuesSchema, &values); err != nil {
+			return fixity.Mutation{}, nil, nil, fmt.Errorf("read values: %v", err)
+		}
+	}
+
+	var data fixity.Reader
+	if mutation.DataSchema != "" {
+		dr, err := datareader.Open(ctx, s.bstor, mutation.DataSchema, s.readConfig)
+		if err != nil {
+			return fixity.Mutation{}, nil, nil, fmt.Errorf("datareader open: %v", err)
+		}
+		data = dr
+	}
+
+	// values will be nil if not defined, which is okay.
+	return mutation, values.Values, data, nil
+}
+
+// Reindex rebuilds the index of the store from the mutations of its
+// blobstore, indexing only the mutations verified by the hook.
+func (s *Store) Reindex(ctx context.Context) (reindex.Report, error) {
+	lr, ok := s.bstor.(reindex.ListReader)
+	if !ok {
+		return reindex.Report{}, errors.New("blobstore does not support listing blobs")
+	}
+
+	// a nil hook must not be passed as a non-nil Verifier.
+	var v reindex.Verifier
+	if s.hook != nil {
+		v = s.hook
+	}
+
+	return reindex.Reindex(ctx, lr, s.index, v)
+}
+
+func (s *Store) verify(ctx context.Context, m fixity.Mutation) error {
+	if s.hook == nil {
+		return nil
+	}
+	return s.hook.Verify(ctx, m)
+}
@@ -0,0 +1,139 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/index/sqlite"
+	"github.com/leeola/fixity/value"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "fixity-base")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := sqlite.Open(filepath.Join(dir, "index.sqlite"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	s := New(Config{Blobstore: memory.New(), Index: ix})
+	return s, func() {
+		ix.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// writeVersions writes n versions of the id, returning the mutation refs
+// oldest first.
+func writeVersions(t *testing.T, s *Store, id string, n int) []fixity.Ref {
+	var refs []fixity.Ref
+	for i := 0; i < n; i++ {
+		written, err := s.Write(context.Background(), id, fixity.Values{
+			"version": value.Int(i),
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, written[len(written)-1])
+	}
+	return refs
+}
+
+func TestStorePrevious(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	refs := writeVersions(t, s, "foo", 3)
+	// another id must not be linked to foo.
+	writeVersions(t, s, "bar", 1)
+
+	for i, ref := range refs {
+		m, v, _, err := s.ReadRef(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want fixity.Ref
+		if i > 0 {
+			want = refs[i-1]
+		}
+		if m.Previous != want {
+			t.Errorf("version %d want previous:%q, got:%q", i, want, m.Previous)
+		}
+
+		if got := v["version"].IntValue; got != i {
+			t.Errorf("version %d got values of version %d", i, got)
+		}
+	}
+
+	m, _, _, err := s.Read(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Previous != refs[1] {
+		t.Errorf("read want previous:%q, got:%q", refs[1], m.Previous)
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	// 3 versions, and more versions than the default query limit.
+	for _, n := range []int{1, 3, 25} {
+		id := fmt.Sprintf("id%d", n)
+		refs := writeVersions(t, s, id, n)
+
+		history, err := s.History(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(history) != n {
+			t.Fatalf("%s want %d versions, got:%d", id, n, len(history))
+		}
+		for i, ref := range history {
+			if want := refs[n-1-i]; ref != want {
+				t.Errorf("%s history %d want:%q, got:%q", id, i, want, ref)
+			}
+		}
+	}
+
+	if _, err := s.History(context.Background(), "missing"); err == nil {
+		t.Error("want err for a missing id")
+	}
+}
+
+func TestStoreWriteWithOptions(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	at := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	refs, err := s.WriteWithOptions(ctx, "foo", fixity.Values{"a": value.Int(1)}, nil,
+		fixity.WriteOptions{Namespace: "ns", Time: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, _, err := s.ReadRef(ctx, refs[len(refs)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Namespace != "ns" || !m.Time.Equal(at) {
+		t.Errorf("want namespace:ns time:%s, got namespace:%q time:%s", at, m.Namespace, m.Time)
+	}
+}
@@ -0,0 +1,13 @@
+package signed
+
+import "errors"
+
+var (
+	// ErrUnknownSigner is returned when a mutation is signed by a key
+	// that the store does not trust.
+	ErrUnknownSigner = errors.New("unknown signer")
+
+	// ErrInvalidSignature is returned when a mutation signature does not
+	// match the signed mutation.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
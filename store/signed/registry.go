@@ -0,0 +1,309 @@
+package signed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/index"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/value"
+)
+
+const (
+	// SignerActionKey is the values key of a signer record describing
+	// the action of the record.
+	SignerActionKey = "signerAction"
+
+	// SignerPreviousKey is the values key of an added signer record
+	// referencing the key it replaced, if the signer was rotated.
+	SignerPreviousKey = "signerPrevious"
+
+	// SignerNextKey is the values key of a revoked signer record
+	// referencing the key that replaced it, if the signer was rotated.
+	SignerNextKey = "signerNext"
+
+	// SignerActionAdd trusts the signer from the time of the record.
+	SignerActionAdd = "add"
+
+	// SignerActionRevoke distrusts the signer from the time of the record.
+	SignerActionRevoke = "revoke"
+
+	// SignerActionDistrust distrusts every signature of the signer, at
+	// any time, such as for a compromised key. It is only honored if
+	// signed by a root signer.
+	SignerActionDistrust = "distrust"
+)
+
+// Registry answers whether a signer was trusted at a given time, from
+// signer records published in the fixity.ReservedNamespaceSigners
+// namespace.
+//
+// Each record is a signed mutation whose ID is the base58 public key of
+// the signer it describes. A record is only honored if it was signed by a
+// root signer or by a signer that was itself trusted at the time of the
+// record, allowing trusted writers to onboard and offboard other writers.
+//
+// Root signers are always trusted, and cannot be revoked by records.
+//
+// The records of a signer are ordered by their Mutation.Previous chain,
+// which cannot be rewritten without forking it, and a signer whose records
+// fork is not trusted. A record with a Time before that of the preceding
+// record is ignored, so records cannot be backdated before existing
+// records.
+//
+// Mutations are still matched to records by Mutation.Time, which is chosen
+// by the signer. A revoked signer can backdate mutations, or records
+// vouching for other signers, to a time it was trusted, so revocation
+// stops honest use of a key but does not protect against a compromised
+// key. A compromised key must be distrusted by a root signer, which
+// rejects every signature of the key regardless of time.
+type Registry struct {
+	bs    fixity.BlobReader
+	qr    index.Querier
+	roots map[string]bool
+
+	// mu guards cache, the verified records of each signer, keyed by
+	// the refs of the indexed records they were read from.
+	mu    sync.Mutex
+	cache map[string]cachedRecords
+}
+
+type cachedRecords struct {
+	refs    string
+	records []signerRecord
+}
+
+func NewRegistry(bs fixity.BlobReader, qr index.Querier, roots []string) *Registry {
+	rootsMap := make(map[string]bool, len(roots))
+	for _, r := range roots {
+		rootsMap[r] = true
+	}
+
+	return &Registry{
+		bs:    bs,
+		qr:    qr,
+		roots: rootsMap,
+		cache: map[string]cachedRecords{},
+	}
+}
+
+// signerRecord is a verified signer record.
+type signerRecord struct {
+	Signer string
+	Time   time.Time
+	Action string
+
+	previous fixity.Ref
+}
+
+// Trusted returns whether the signer was trusted at time t.
+func (r *Registry) Trusted(ctx context.Context, signer string, t time.Time) (bool, error) {
+	return r.trusted(ctx, signer, t, map[string]bool{})
+}
+
+// trusted implements Trusted, tracking the signers being resolved to
+// avoid cycles of signers vouching for each other.
+func (r *Registry) trusted(ctx context.Context, signer string, t time.Time, resolving map[string]bool) (bool, error) {
+	if r.roots[signer] {
+		return true, nil
+	}
+
+	if resolving[signer] {
+		return false, nil
+	}
+	resolving[signer] = true
+	defer delete(resolving, signer)
+
+	records, err := r.records(ctx, signer)
+	if err != nil {
+		return false, fmt.Errorf("records: %v", err)
+	}
+
+	for _, rec := range records {
+		if rec.Action == SignerActionDistrust && r.roots[rec.Signer] {
+			return false, nil
+		}
+	}
+
+	// walk from the newest record to the oldest, stopping at the first
+	// valid record that applies to t.
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Action == SignerActionDistrust {
+			continue
+		}
+
+		rec := records[i]
+		if rec.Time.After(t) {
+			continue
+		}
+
+		ok, err := r.trusted(ctx, rec.Signer, rec.Time, resolving)
+		if err != nil {
+			return false, err // no wrap recursive err
+		}
+		if !ok {
+			continue
+		}
+
+		return rec.Action == SignerActionAdd, nil
+	}
+
+	return false, nil
+}
+
+// records returns the signature verified records of the signer, ordered
+// by their previous chain.
+//
+// The records are cached until the indexed records of the signer change.
+func (r *Registry) records(ctx context.Context, signer string) ([]signerRecord, error) {
+	matches, err := r.matches(signer)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	refs := make([]string, len(matches))
+	for i, match := range matches {
+		refs[i] = string(match.Ref)
+	}
+	sort.Strings(refs)
+	key := strings.Join(refs, ",")
+
+	r.mu.Lock()
+	cached, ok := r.cache[signer]
+	r.mu.Unlock()
+	if ok && cached.refs == key {
+		return cached.records, nil
+	}
+
+	records, err := r.readRecords(ctx, signer, matches)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+
+	r.mu.Lock()
+	r.cache[signer] = cachedRecords{refs: key, records: records}
+	r.mu.Unlock()
+
+	return records, nil
+}
+
+// readRecords reads and verifies the records of the matches, ordering them
+// by their previous chain.
+func (r *Registry) readRecords(ctx context.Context, signer string, matches []fixity.Match) ([]signerRecord, error) {
+	var (
+		byRef = map[fixity.Ref]signerRecord{}
+		// next is the record following each previous record.
+		next = map[fixity.Ref]fixity.Ref{}
+	)
+	for _, match := range matches {
+		if _, ok := byRef[match.Ref]; ok {
+			continue
+		}
+
+		var m fixity.Mutation
+		if err := blobstore.ReadAndUnmarshal(ctx, r.bs, match.Ref, &m); err != nil {
+			return nil, fmt.Errorf("read mutation %q: %v", match.Ref, err)
+		}
+
+		// the id index is shared by all namespaces, so ignore any
+		// mutation that is not actually a signer record.
+		if m.SchemaType != fixity.BlobTypeMutation ||
+			m.Namespace != fixity.ReservedNamespaceSigners ||
+			m.ID != signer || m.ValuesSchema == "" {
+			continue
+		}
+
+		if err := Verify(m); err != nil {
+			continue
+		}
+
+		var vs fixity.ValuesSchema
+		if err := blobstore.ReadAndUnmarshal(ctx, r.bs, m.ValuesSchema, &vs); err != nil {
+			return nil, fmt.Errorf("read values %q: %v", m.ValuesSchema, err)
+		}
+
+		action := vs.Values[SignerActionKey]
+		if action.Type != value.TypeString {
+			continue
+		}
+
+		switch action.StringValue {
+		case SignerActionAdd, SignerActionRevoke, SignerActionDistrust:
+		default:
+			continue
+		}
+
+		if _, ok := next[m.Previous]; ok {
+			return nil, fmt.Errorf("signer records fork at %q", m.Previous)
+		}
+		next[m.Previous] = match.Ref
+
+		byRef[match.Ref] = signerRecord{
+			Signer:   m.Signer,
+			Time:     m.Time,
+			Action:   action.StringValue,
+			previous: m.Previous,
+		}
+	}
+
+	// the chain starts at the only record not following another record.
+	var first fixity.Ref
+	for _, rec := range byRef {
+		if _, ok := byRef[rec.previous]; ok {
+			continue
+		}
+		if first != "" {
+			return nil, errors.New("signer records fork")
+		}
+		first = next[rec.previous]
+	}
+
+	var records []signerRecord
+	for ref := first; ref != ""; ref = next[ref] {
+		rec := byRef[ref]
+
+		// a record cannot be backdated before the preceding record.
+		if len(records) > 0 && rec.Time.Before(records[len(records)-1].Time) {
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// matches returns every version of the signer id, paging through the
+// querier.
+func (r *Registry) matches(signer string) ([]fixity.Match, error) {
+	_, cursors := r.qr.(fixity.PageQuerier)
+
+	var (
+		qu      = q.New().WithVersions().Eq(index.FIDKey, value.String(signer))
+		matches []fixity.Match
+	)
+	for {
+		page, err := fixity.QueryPage(r.qr, qu)
+		if err != nil {
+			return nil, fmt.Errorf("query: %v", err)
+		}
+		matches = append(matches, page.Matches...)
+
+		switch {
+		case page.Next != "":
+			qu.After = page.Next
+		// queriers without cursors are paged by offset.
+		case !cursors && len(page.Matches) == qu.LimitBy:
+			qu.Offset += len(page.Matches)
+		default:
+			return matches, nil
+		}
+	}
+}
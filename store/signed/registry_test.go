@@ -0,0 +1,290 @@
+package signed
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"testing"
+	"time"
+
+	base58 "github.com/jbenet/go-base58"
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/util/wutil"
+	"github.com/leeola/fixity/value"
+)
+
+type testKey struct {
+	pub  string
+	priv ed25519.PrivateKey
+}
+
+func newTestKey(t *testing.T) testKey {
+	_, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecodePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{
+		pub:  base58.Encode(key.Public().(ed25519.PublicKey)),
+		priv: key,
+	}
+}
+
+// writeRecord writes and indexes a signer record following the last
+// indexed record of the signer, returning its ref.
+func writeRecord(t *testing.T, bs *memory.Store, ix memIndex,
+	by testKey, signer string, action string, at time.Time) fixity.Ref {
+
+	var previous fixity.Ref
+	if matches := ix[signer]; len(matches) > 0 {
+		previous = matches[len(matches)-1].Ref
+	}
+	return writeRecordAfter(t, bs, ix, by, signer, action, at, previous)
+}
+
+func writeRecordAfter(t *testing.T, bs *memory.Store, ix memIndex,
+	by testKey, signer string, action string, at time.Time, previous fixity.Ref) fixity.Ref {
+
+	ctx := context.Background()
+
+	valuesRef, err := wutil.WriteValues(ctx, bs, fixity.Values{
+		SignerActionKey: value.String(action),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Sign(by.priv, fixity.Mutation{
+		Schema: fixity.Schema{
+			SchemaType: fixity.BlobTypeMutation,
+		},
+		ID:           signer,
+		Namespace:    fixity.ReservedNamespaceSigners,
+		Time:         at,
+		ValuesSchema: valuesRef,
+		Previous:     previous,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := wutil.MarshalAndWrite(ctx, bs, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Index(ref, m, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return ref
+}
+
+func TestRegistryTrusted(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ix  = memIndex{}
+		ctx = context.Background()
+
+		root     = newTestKey(t)
+		writer   = newTestKey(t)
+		unknown  = newTestKey(t)
+		vouched  = newTestKey(t)
+		t0       = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		added    = t0.Add(time.Hour)
+		revoked  = t0.Add(2 * time.Hour)
+		afterAll = t0.Add(3 * time.Hour)
+	)
+
+	writeRecord(t, bs, ix, root, writer.pub, SignerActionAdd, added)
+	writeRecord(t, bs, ix, root, writer.pub, SignerActionRevoke, revoked)
+	// records from untrusted signers must be ignored.
+	writeRecord(t, bs, ix, unknown, unknown.pub, SignerActionAdd, t0)
+	// records from signers trusted at the time are honored.
+	writeRecord(t, bs, ix, writer, vouched.pub, SignerActionAdd, added.Add(time.Minute))
+	writeRecord(t, bs, ix, writer, vouched.pub, SignerActionRevoke, afterAll)
+
+	r := NewRegistry(bs, ix, []string{root.pub})
+
+	testCases := []struct {
+		Name   string
+		Signer string
+		Time   time.Time
+		Want   bool
+	}{
+		{"root", root.pub, t0, true},
+		{"before add", writer.pub, t0, false},
+		{"at add", writer.pub, added, true},
+		{"between", writer.pub, added.Add(time.Minute), true},
+		{"at revoke", writer.pub, revoked, false},
+		{"after revoke", writer.pub, afterAll, false},
+		{"self added", unknown.pub, afterAll, false},
+		{"vouched", vouched.pub, revoked, true},
+		// records from a signer written after it was revoked are ignored.
+		{"revoked revoke", vouched.pub, afterAll, true},
+	}
+	for _, tc := range testCases {
+		got, err := r.Trusted(ctx, tc.Signer, tc.Time)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if got != tc.Want {
+			t.Errorf("%s want:%t, got:%t", tc.Name, tc.Want, got)
+		}
+	}
+}
+
+func TestRegistryManyRecords(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ix  = memIndex{}
+		ctx = context.Background()
+
+		root   = newTestKey(t)
+		writer = newTestKey(t)
+		t0     = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	// more records than the default query limit, alternating between add
+	// and revoke.
+	const n = 25
+	for i := 0; i < n; i++ {
+		action := SignerActionAdd
+		if i%2 == 1 {
+			action = SignerActionRevoke
+		}
+		writeRecord(t, bs, ix, root, writer.pub, action, t0.Add(time.Duration(i)*time.Hour))
+	}
+
+	r := NewRegistry(bs, ix, []string{root.pub})
+
+	for i := 0; i < n; i++ {
+		at := t0.Add(time.Duration(i)*time.Hour + time.Minute)
+		got, err := r.Trusted(ctx, writer.pub, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i%2 == 0; got != want {
+			t.Errorf("record %d want:%t, got:%t", i, want, got)
+		}
+	}
+}
+
+// countingStore counts the blobs read.
+type countingStore struct {
+	*memory.Store
+	reads *int
+}
+
+func (s countingStore) Read(ctx context.Context, ref fixity.Ref) (io.ReadCloser, error) {
+	*s.reads++
+	return s.Store.Read(ctx, ref)
+}
+
+func TestRegistryChain(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ix  = memIndex{}
+		ctx = context.Background()
+
+		root      = newTestKey(t)
+		writer    = newTestKey(t)
+		forked    = newTestKey(t)
+		distrust  = newTestKey(t)
+		ignored   = newTestKey(t)
+		t0        = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		afterAll  = t0.Add(3 * time.Hour)
+		beforeAll = t0.Add(-time.Hour)
+	)
+
+	// a revoke followed by an add backdated before it is still revoked.
+	writeRecord(t, bs, ix, root, writer.pub, SignerActionAdd, t0)
+	writeRecord(t, bs, ix, root, writer.pub, SignerActionRevoke, t0.Add(time.Hour))
+	writeRecord(t, bs, ix, root, writer.pub, SignerActionAdd, t0.Add(time.Minute))
+
+	// a record forking the chain, such as to hide the revoke.
+	first := writeRecord(t, bs, ix, root, forked.pub, SignerActionAdd, t0)
+	writeRecord(t, bs, ix, root, forked.pub, SignerActionRevoke, t0.Add(time.Hour))
+	writeRecordAfter(t, bs, ix, writer, forked.pub, SignerActionAdd, t0.Add(time.Minute), first)
+
+	// distrusted by a root, before the signer was added.
+	writeRecord(t, bs, ix, root, distrust.pub, SignerActionAdd, t0)
+	writeRecord(t, bs, ix, root, distrust.pub, SignerActionDistrust, t0.Add(time.Hour))
+
+	// distrust is only honored from roots.
+	writeRecord(t, bs, ix, root, ignored.pub, SignerActionAdd, t0)
+	writeRecord(t, bs, ix, writer, ignored.pub, SignerActionDistrust, t0.Add(time.Second))
+
+	r := NewRegistry(bs, ix, []string{root.pub})
+
+	testCases := []struct {
+		Name    string
+		Signer  string
+		Time    time.Time
+		Want    bool
+		WantErr bool
+	}{
+		{"before backdated", writer.pub, t0.Add(time.Second), true, false},
+		{"backdated", writer.pub, afterAll, false, false},
+		{"forked", forked.pub, t0.Add(time.Second), false, true},
+		{"distrusted", distrust.pub, t0.Add(time.Minute), false, false},
+		{"distrusted before", distrust.pub, beforeAll, false, false},
+		{"distrust from non root", ignored.pub, afterAll, true, false},
+	}
+	for _, tc := range testCases {
+		got, err := r.Trusted(ctx, tc.Signer, tc.Time)
+		if (err != nil) != tc.WantErr {
+			t.Errorf("%s want err:%t, got:%v", tc.Name, tc.WantErr, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("%s want:%t, got:%t", tc.Name, tc.Want, got)
+		}
+	}
+}
+
+func TestRegistryCache(t *testing.T) {
+	var (
+		ms  = memory.New()
+		ix  = memIndex{}
+		ctx = context.Background()
+
+		root   = newTestKey(t)
+		writer = newTestKey(t)
+		t0     = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	writeRecord(t, ms, ix, root, writer.pub, SignerActionAdd, t0)
+
+	var reads int
+	r := NewRegistry(countingStore{Store: ms, reads: &reads}, ix, []string{root.pub})
+
+	trusted := func(want bool) {
+		got, err := r.Trusted(ctx, writer.pub, t0.Add(2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("want trusted:%t, got:%t", want, got)
+		}
+	}
+
+	trusted(true)
+	if reads == 0 {
+		t.Fatal("want records read")
+	}
+
+	reads = 0
+	trusted(true)
+	if reads != 0 {
+		t.Errorf("want cached records, got %d reads", reads)
+	}
+
+	// new records are read.
+	writeRecord(t, ms, ix, root, writer.pub, SignerActionRevoke, t0.Add(time.Hour))
+	trusted(false)
+}
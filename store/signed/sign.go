@@ -0,0 +1,98 @@
+package signed
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	base58 "github.com/jbenet/go-base58"
+	"github.com/leeola/fixity"
+)
+
+// GenerateKey returns a new base58 encoded ed25519 key pair, suitable for
+// the store Config.
+func GenerateKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("generatekey: %v", err)
+	}
+
+	return base58.Encode(pub), base58.Encode(priv), nil
+}
+
+// DecodePrivateKey decodes a base58 encoded ed25519 private key.
+func DecodePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b := base58.Decode(s)
+	if len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key length: %d", len(b))
+	}
+
+	return ed25519.PrivateKey(b), nil
+}
+
+// DecodePublicKey decodes a base58 encoded ed25519 public key, the format
+// used by Mutation.Signer.
+func DecodePublicKey(s string) (ed25519.PublicKey, error) {
+	b := base58.Decode(s)
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length: %d", len(b))
+	}
+
+	return ed25519.PublicKey(b), nil
+}
+
+// MutationBytes returns the canonical bytes of the mutation that are
+// signed, which is the json encoded mutation without a signature.
+func MutationBytes(m fixity.Mutation) ([]byte, error) {
+	m.Signature = ""
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %v", err)
+	}
+
+	return b, nil
+}
+
+// Sign sets the Signer and Signature of the given mutation from the
+// private key.
+func Sign(key ed25519.PrivateKey, m fixity.Mutation) (fixity.Mutation, error) {
+	m.Signer = base58.Encode(key.Public().(ed25519.PublicKey))
+
+	b, err := MutationBytes(m)
+	if err != nil {
+		return fixity.Mutation{}, err // no wrap helper err
+	}
+
+	m.Signature = base58.Encode(ed25519.Sign(key, b))
+
+	return m, nil
+}
+
+// Verify checks that the mutation Signature was produced by the mutation
+// Signer.
+//
+// Verify does not check if the signer is trusted, only that the signature
+// is valid for the signer.
+func Verify(m fixity.Mutation) error {
+	if m.Signer == "" || m.Signature == "" {
+		return ErrInvalidSignature
+	}
+
+	pub, err := DecodePublicKey(m.Signer)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	b, err := MutationBytes(m)
+	if err != nil {
+		return err // no wrap helper err
+	}
+
+	if !ed25519.Verify(pub, b, base58.Decode(m.Signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package signed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+)
+
+func TestSignVerify(t *testing.T) {
+	_, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := DecodePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Sign(key, fixity.Mutation{
+		Schema: fixity.Schema{
+			SchemaType: fixity.BlobTypeMutation,
+		},
+		ID:         "foo",
+		Time:       time.Now(),
+		DataSchema: "bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(m); err != nil {
+		t.Errorf("want valid signature, got: %v", err)
+	}
+
+	forged := m
+	forged.DataSchema = "baz"
+	if err := Verify(forged); err != ErrInvalidSignature {
+		t.Errorf("want:%v, got:%v", ErrInvalidSignature, err)
+	}
+
+	unsigned := m
+	unsigned.Signature = ""
+	if err := Verify(unsigned); err != ErrInvalidSignature {
+		t.Errorf("want:%v, got:%v", ErrInvalidSignature, err)
+	}
+}
@@ -0,0 +1,171 @@
+package signed
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	base58 "github.com/jbenet/go-base58"
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/config"
+	"github.com/leeola/fixity/reader/datareader"
+	"github.com/leeola/fixity/store/base"
+	"github.com/leeola/fixity/value"
+)
+
+type Config struct {
+	BlobstoreName string `json:"blobstoreName"`
+	IndexName     string `json:"indexName"`
+
+	// PrivateKey is the base58 encoded ed25519 private key used to sign
+	// written mutations.
+	PrivateKey string `json:"privateKey"`
+
+	// TrustedSigners are base58 encoded ed25519 public keys that are
+	// always trusted when reading mutations, the roots of the signer
+	// Registry.
+	//
+	// The public key of PrivateKey is always trusted.
+	TrustedSigners []string `json:"trustedSigners,omitempty"`
+
+	// Config of the data readers, such as the read-ahead window.
+	datareader.Config
+}
+
+// Store implements a Fixity Store which signs all written mutations and
+// verifies the signature of all read mutations.
+type Store struct {
+	*base.Store
+}
+
+func New(name string, fc config.Config) (*Store, error) {
+	var c Config
+	if err := fc.StoreConfig(name, &c); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %v", err)
+	}
+
+	if c.PrivateKey == "" {
+		return nil, errors.New("missing required config: privateKey")
+	}
+
+	key, err := DecodePrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decodeprivatekey: %v", err)
+	}
+
+	for _, signer := range c.TrustedSigners {
+		if _, err := DecodePublicKey(signer); err != nil {
+			return nil, fmt.Errorf("trusted signer %q: %v", signer, err)
+		}
+	}
+
+	bc, err := base.ConfigFrom(name, fc, c.BlobstoreName, c.IndexName)
+	if err != nil {
+		return nil, err // no wrap helper err
+	}
+	bc.ReadConfig = c.Config
+
+	return newStore(bc, key, c.TrustedSigners), nil
+}
+
+// newStore returns a Store signing with key and trusting the signers of
+// the registry rooted at key and the trusted signers.
+func newStore(bc base.Config, key ed25519.PrivateKey, trusted []string) *Store {
+	roots := append([]string{base58.Encode(key.Public().(ed25519.PublicKey))}, trusted...)
+
+	bc.Hook = signHook{
+		key:      key,
+		registry: NewRegistry(bc.Blobstore, bc.Index, roots),
+	}
+
+	return &Store{Store: base.New(bc)}
+}
+
+// AddSigner publishes a record trusting the signer from now on.
+func (s *Store) AddSigner(ctx context.Context, signer string) ([]fixity.Ref, error) {
+	return s.writeSignerRecord(ctx, time.Now(), signer, fixity.Values{
+		SignerActionKey: value.String(SignerActionAdd),
+	})
+}
+
+// RevokeSigner publishes a record distrusting the signer from now on.
+//
+// Mutations signed by the signer before the revocation remain trusted.
+func (s *Store) RevokeSigner(ctx context.Context, signer string) ([]fixity.Ref, error) {
+	return s.writeSignerRecord(ctx, time.Now(), signer, fixity.Values{
+		SignerActionKey: value.String(SignerActionRevoke),
+	})
+}
+
+// DistrustSigner publishes a record distrusting every signature of the
+// signer, including those before the record, such as for a compromised
+// key. The record is only honored if the key of the store is a root
+// signer of the reading store.
+func (s *Store) DistrustSigner(ctx context.Context, signer string) ([]fixity.Ref, error) {
+	return s.writeSignerRecord(ctx, time.Now(), signer, fixity.Values{
+		SignerActionKey: value.String(SignerActionDistrust),
+	})
+}
+
+// RotateSigner publishes records revoking the previous signer and adding
+// the next signer, at the same point in time.
+func (s *Store) RotateSigner(ctx context.Context, previous, next string) ([]fixity.Ref, error) {
+	if _, err := DecodePublicKey(next); err != nil {
+		return nil, fmt.Errorf("next signer: %v", err)
+	}
+
+	t := time.Now()
+
+	refs, err := s.writeSignerRecord(ctx, t, previous, fixity.Values{
+		SignerActionKey: value.String(SignerActionRevoke),
+		SignerNextKey:   value.String(next),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("revoke previous: %v", err)
+	}
+
+	nextRefs, err := s.writeSignerRecord(ctx, t, next, fixity.Values{
+		SignerActionKey:   value.String(SignerActionAdd),
+		SignerPreviousKey: value.String(previous),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("add next: %v", err)
+	}
+
+	return append(refs, nextRefs...), nil
+}
+
+func (s *Store) writeSignerRecord(ctx context.Context, t time.Time, signer string, v fixity.Values) ([]fixity.Ref, error) {
+	if _, err := DecodePublicKey(signer); err != nil {
+		return nil, fmt.Errorf("signer %q: %v", signer, err)
+	}
+
+	return s.WriteTimeNamespace(ctx, t, signer, fixity.ReservedNamespaceSigners, v, nil)
+}
+
+// signHook signs written mutations with the key of the store and
+// verifies read mutations against the registry.
+type signHook struct {
+	key      ed25519.PrivateKey
+	registry *Registry
+}
+
+func (h signHook) Sign(m fixity.Mutation) (fixity.Mutation, error) {
+	return Sign(h.key, m)
+}
+
+// Verify returns an error if the mutation signer was not trusted at the
+// time of the mutation or if the signature is invalid.
+func (h signHook) Verify(ctx context.Context, m fixity.Mutation) error {
+	ok, err := h.registry.Trusted(ctx, m.Signer, m.Time)
+	if err != nil {
+		return fmt.Errorf("trusted: %v", err)
+	}
+	if !ok {
+		return ErrUnknownSigner
+	}
+
+	return Verify(m)
+}
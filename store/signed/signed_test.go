@@ -0,0 +1,220 @@
+package signed
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/q"
+	"github.com/leeola/fixity/store/base"
+	"github.com/leeola/fixity/util/wutil"
+	"github.com/leeola/fixity/value"
+)
+
+// memIndex is a minimal fixity.Index of ids, honoring IncludeVersions,
+// Offset and LimitBy.
+type memIndex map[string][]fixity.Match
+
+func (ix memIndex) Index(ref fixity.Ref, m fixity.Mutation, _ *fixity.DataSchema, _ fixity.Values) error {
+	ix[m.ID] = append(ix[m.ID], fixity.Match{ID: m.ID, Ref: ref})
+	return nil
+}
+
+func (ix memIndex) Query(qu q.Query) ([]fixity.Match, error) {
+	matches := ix[qu.Constraint.Value.StringValue]
+	if !qu.IncludeVersions && len(matches) > 0 {
+		matches = matches[len(matches)-1:]
+	}
+
+	if qu.Offset >= len(matches) {
+		return nil, nil
+	}
+	matches = matches[qu.Offset:]
+
+	if qu.LimitBy > 0 && len(matches) > qu.LimitBy {
+		matches = matches[:qu.LimitBy]
+	}
+	return matches, nil
+}
+
+func TestStoreReadRef(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ctx = context.Background()
+
+		owner   = newTestKey(t)
+		writer  = newTestKey(t)
+		unknown = newTestKey(t)
+	)
+
+	s := newStore(base.Config{Blobstore: bs, Index: memIndex{}}, owner.priv, nil)
+
+	if _, err := s.AddSigner(ctx, writer.pub); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := s.Write(ctx, "foo", fixity.Values{"name": value.String("a")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerRef := refs[len(refs)-1]
+
+	var m fixity.Mutation
+	if err := blobstore.ReadAndUnmarshal(ctx, bs, ownerRef, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	writeMutation := func(m fixity.Mutation) fixity.Ref {
+		ref, err := wutil.MarshalAndWrite(ctx, bs, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+
+	signMutation := func(by testKey, m fixity.Mutation) fixity.Ref {
+		m, err := Sign(by.priv, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeMutation(m)
+	}
+
+	forged := m
+	forged.ID = "bar"
+
+	testCases := []struct {
+		Name    string
+		Ref     fixity.Ref
+		WantErr error
+	}{
+		{"owner", ownerRef, nil},
+		{"registered", signMutation(writer, m), nil},
+		{"forged", writeMutation(forged), ErrInvalidSignature},
+		{"unregistered", signMutation(unknown, m), ErrUnknownSigner},
+		// signed after the time of the mutation would be trusted, but the
+		// signer was not registered at the time of the mutation.
+		{"before registered", signMutation(writer, fixity.Mutation{
+			Schema:       m.Schema,
+			ID:           m.ID,
+			Time:         m.Time.Add(-time.Hour),
+			ValuesSchema: m.ValuesSchema,
+		}), ErrUnknownSigner},
+	}
+	for _, tc := range testCases {
+		_, _, _, err := s.ReadRef(ctx, tc.Ref)
+		switch {
+		case tc.WantErr == nil && err != nil:
+			t.Errorf("%s: %v", tc.Name, err)
+		case tc.WantErr != nil && (err == nil || !strings.Contains(err.Error(), tc.WantErr.Error())):
+			t.Errorf("%s want err:%q, got:%v", tc.Name, tc.WantErr, err)
+		}
+	}
+}
+
+func TestStoreHistoryVerifies(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ix  = memIndex{}
+		ctx = context.Background()
+
+		owner   = newTestKey(t)
+		unknown = newTestKey(t)
+	)
+
+	s := newStore(base.Config{Blobstore: bs, Index: ix}, owner.priv, nil)
+
+	refs, err := s.Write(ctx, "foo", fixity.Values{"name": value.String("a")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Sign(unknown.priv, fixity.Mutation{
+		Schema:   fixity.Schema{SchemaType: fixity.BlobTypeMutation},
+		ID:       "foo",
+		Time:     time.Now(),
+		Previous: refs[len(refs)-1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := wutil.MarshalAndWrite(ctx, bs, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Index(ref, m, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.History(ctx, "foo"); err == nil || !strings.Contains(err.Error(), ErrUnknownSigner.Error()) {
+		t.Errorf("history want err:%q, got:%v", ErrUnknownSigner, err)
+	}
+
+	// the unverified head is neither read nor linked as previous.
+	if _, _, _, err := s.Read(ctx, "foo"); err == nil || !strings.Contains(err.Error(), ErrUnknownSigner.Error()) {
+		t.Errorf("read want err:%q, got:%v", ErrUnknownSigner, err)
+	}
+	if _, err := s.Write(ctx, "foo", fixity.Values{"name": value.String("b")}, nil); err == nil ||
+		!strings.Contains(err.Error(), ErrUnknownSigner.Error()) {
+		t.Errorf("write want err:%q, got:%v", ErrUnknownSigner, err)
+	}
+}
+
+func TestStoreReindex(t *testing.T) {
+	var (
+		bs  = memory.New()
+		ctx = context.Background()
+
+		owner   = newTestKey(t)
+		writer  = newTestKey(t)
+		unknown = newTestKey(t)
+	)
+
+	s := newStore(base.Config{Blobstore: bs, Index: memIndex{}}, owner.priv, nil)
+	if _, err := s.AddSigner(ctx, writer.pub); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newStore(base.Config{Blobstore: bs, Index: memIndex{}}, writer.priv, nil)
+	if _, err := w.Write(ctx, "foo", fixity.Values{"name": value.String("a")}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := Sign(unknown.priv, fixity.Mutation{
+		Schema: fixity.Schema{SchemaType: fixity.BlobTypeMutation},
+		ID:     "bar",
+		Time:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedRef, err := wutil.MarshalAndWrite(ctx, bs, forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signer record is indexed before the mutation it trusts.
+	s = newStore(base.Config{Blobstore: bs, Index: memIndex{}}, owner.priv, nil)
+	report, err := s.Reindex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Indexed != 2 {
+		t.Errorf("want:2 indexed, got:%d", report.Indexed)
+	}
+	if len(report.Unverified) != 1 || report.Unverified[0] != forgedRef {
+		t.Errorf("want unverified:[%s], got:%v", forgedRef, report.Unverified)
+	}
+
+	if _, _, _, err := s.Read(ctx, "foo"); err != nil {
+		t.Errorf("read foo: %v", err)
+	}
+	if _, _, _, err := s.Read(ctx, "bar"); err == nil {
+		t.Error("want err reading the unverified bar")
+	}
+}
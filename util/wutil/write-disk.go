@@ -6,66 +6,107 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/leeola/fixity"
 	"github.com/leeola/fixity/chunk"
+	"github.com/leeola/fixity/config"
+
+	// register the default chunker.
+	_ "github.com/leeola/fixity/chunk/resticfork"
 )
 
 const partSize = 100
 
-func WriteData(ctx context.Context, w fixity.BlobWriter, chunkRefs []fixity.Ref, totalSize int64, contentHash string) ([]fixity.Ref, *fixity.DataSchema, error) {
+// WriteReader chunks the given reader with the configured chunker and
+// writes the chunks and the resulting DataSchema to the BlobWriter.
+//
+// The last ref of the returned refs is the DataSchema ref.
+func WriteReader(ctx context.Context, w fixity.BlobWriter, r io.Reader, c config.ChunkerConfig) ([]fixity.Ref, *fixity.DataSchema, error) {
+	chunker, err := chunk.New(r, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chunker new: %v", err)
+	}
 
-	chunkRefLen := len(chunkRefs)
+	cHashes, cSizes, totalSize, checksum, err := WriteChunks(ctx, w, chunker)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writechunker: %v", err)
+	}
 
-	// -1 ensures that the morePartCount doesn't increase at an equal divide,
-	// like 2 items for a pagesize of 2, would only need 1 page, yet morePartCount
-	// would indicate that there's a morePart page as well.
-	//
-	//
-	// I feel like that made no sense.
-	morePartCount := (chunkRefLen - 1) / partSize
+	refs, data, err := WriteData(ctx, w, cHashes, cSizes, totalSize, checksum)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writecontent: %v", err)
+	}
 
-	var lastPart *fixity.Ref
+	return refs, data, nil
+}
 
-	// write all of the parts first, including the partial final part..
-	// ie, the part that has less than the max chunks.
-	for i := morePartCount; i > 0; i-- {
-		startBound := partSize * i
-		endBound := startBound + partSize
-		if i == morePartCount {
-			endBound = startBound + chunkRefLen%partSize
-		}
+// WriteData writes the DataSchema and the balanced tree of PartsSchemas of
+// the given chunks.
+//
+// chunkSizes may be nil if the sizes of the chunks are unknown, otherwise
+// it must be the same length as chunkRefs.
+func WriteData(ctx context.Context, w fixity.BlobWriter, chunkRefs []fixity.Ref, chunkSizes []int64, totalSize int64, contentHash string) ([]fixity.Ref, *fixity.DataSchema, error) {
+	if chunkSizes != nil && len(chunkSizes) != len(chunkRefs) {
+		return nil, nil, fmt.Errorf("got %d chunk sizes for %d chunks", len(chunkSizes), len(chunkRefs))
+	}
 
-		part := fixity.PartsSchema{
-			Schema: fixity.Schema{
-				SchemaType: fixity.BlobTypeParts,
-			},
-			Parts:     chunkRefs[startBound:endBound],
-			MoreParts: lastPart,
-		}
+	written := append([]fixity.Ref(nil), chunkRefs...)
+
+	// build the balanced tree from the chunks up, evenly dividing each
+	// level into nodes of at most partSize parts, until the remaining
+	// parts fit in the DataSchema.
+	refs, sizes := chunkRefs, chunkSizes
+	var height int
+	for len(refs) > partSize {
+		var (
+			nodeRefs  []fixity.Ref
+			nodeSizes []int64
+			nodeCount = (len(refs) + partSize - 1) / partSize
+		)
+		for i := 0; i < nodeCount; i++ {
+			startBound := i * len(refs) / nodeCount
+			endBound := (i + 1) * len(refs) / nodeCount
+
+			part := fixity.PartsSchema{
+				Schema: fixity.Schema{
+					SchemaType: fixity.BlobTypeParts,
+				},
+				Parts:  refs[startBound:endBound],
+				Sizes:  partSizes(sizes, startBound, endBound),
+				Height: height,
+			}
 
-		ref, err := MarshalAndWrite(ctx, w, part)
-		if err != nil {
-			return nil, nil, fmt.Errorf("marshalandwrite part %d: %v", i, err)
+			ref, err := MarshalAndWrite(ctx, w, part)
+			if err != nil {
+				return nil, nil, fmt.Errorf("marshalandwrite part %d/%d: %v", height, i, err)
+			}
+			written = append(written, ref)
+			nodeRefs = append(nodeRefs, ref)
+
+			if sizes != nil {
+				var size int64
+				for _, s := range part.Sizes {
+					size += s
+				}
+				nodeSizes = append(nodeSizes, size)
+			}
 		}
-		chunkRefs = append(chunkRefs, ref)
-		lastPart = &ref
-	}
 
-	endBound := partSize
-	if chunkRefLen < partSize {
-		endBound = chunkRefLen
+		refs, sizes = nodeRefs, nodeSizes
+		height++
 	}
 
 	// now we've written all the parts except for the most important
-	// one, the content which has a part embedded.
+	// one, the content which has the root part embedded.
 	data := fixity.DataSchema{
 		PartsSchema: fixity.PartsSchema{
 			Schema: fixity.Schema{
 				SchemaType: fixity.BlobTypeData,
 			},
-			Parts:     chunkRefs[0:endBound],
-			MoreParts: lastPart,
+			Parts:  refs,
+			Sizes:  sizes,
+			Height: height,
 		},
 		Size:     totalSize,
 		Checksum: contentHash,
@@ -76,44 +117,132 @@ func WriteData(ctx context.Context, w fixity.BlobWriter, chunkRefs []fixity.Ref,
 		return nil, nil, fmt.Errorf("marshalandwrite content: %v", err)
 	}
 
-	return append(chunkRefs, ref), &data, nil
+	return append(written, ref), &data, nil
+}
+
+func partSizes(chunkSizes []int64, start, end int) []int64 {
+	if chunkSizes == nil {
+		return nil
+	}
+	return chunkSizes[start:end]
 }
 
+// DefaultWriteWorkers is the number of concurrent blob writes of
+// WriteChunks.
+const DefaultWriteWorkers = 4
+
+// WriteChunks writes the chunks with DefaultWriteWorkers concurrent writes.
+// See WriteChunksParallel.
 func WriteChunks(ctx context.Context, w fixity.BlobWriter, r chunk.Chunker) (
-	refs []fixity.Ref, totalSize int64, contentHash string, err error) {
+	refs []fixity.Ref, sizes []int64, totalSize int64, contentHash string, err error) {
+
+	return WriteChunksParallel(ctx, w, r, DefaultWriteWorkers)
+}
+
+// chunkWrite is a chunk written by a WriteChunksParallel worker.
+type chunkWrite struct {
+	b   []byte
+	ref fixity.Ref
+}
+
+// WriteChunksParallel chunks and hashes the content while up to the given
+// number of workers write the chunks to the BlobWriter, returning the refs
+// and sizes in the order of the content.
+//
+// Chunking blocks while every worker is busy and as many chunks as there
+// are workers are queued, bounding the chunks held in memory. The first
+// write error cancels chunking and the remaining writes.
+func WriteChunksParallel(ctx context.Context, w fixity.BlobWriter, r chunk.Chunker, workers int) (
+	refs []fixity.Ref, sizes []int64, totalSize int64, contentHash string, err error) {
+
+	if workers < 1 {
+		workers = 1
+	}
 
 	hasher, err := fixity.Hasher(fixity.DefaultMultihashName)
 	if err != nil {
-		return nil, 0, "", fmt.Errorf("hasher: %v", err)
+		return nil, nil, 0, "", fmt.Errorf("hasher: %v", err)
 	}
 
-	var hashes []fixity.Ref
-	for {
-		c, err := r.Chunk(ctx)
-		if err != nil && err != io.EOF {
-			return nil, 0, "", fmt.Errorf("chunk: %v", err)
-		}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		writeErr error
+		jobs     = make(chan *chunkWrite, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				ref, err := w.Write(ctx, job.b)
+				if err != nil {
+					errOnce.Do(func() {
+						writeErr = fmt.Errorf("blob write: %v", err)
+						cancel()
+					})
+				}
+				// release the bytes, only the ref is needed.
+				job.b, job.ref = nil, ref
+			}
+		}()
+	}
 
-		totalSize += c.Size
+	var writes []*chunkWrite
+	chunkErr := func() error {
+		defer close(jobs)
+		for {
+			c, err := r.Chunk(ctx)
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("chunk: %v", err)
+			}
 
-		if err == io.EOF {
-			break
-		}
+			totalSize += c.Size
 
-		if _, err := hasher.Write(c.Bytes); err != nil {
-			return nil, 0, "", fmt.Errorf("hasher write: %v", err)
-		}
+			if err == io.EOF {
+				return nil
+			}
+
+			if _, err := hasher.Write(c.Bytes); err != nil {
+				return fmt.Errorf("hasher write: %v", err)
+			}
+
+			// chunkers may reuse the chunk bytes on the next Chunk call.
+			job := &chunkWrite{
+				b: append([]byte(nil), c.Bytes...),
+			}
 
-		h, err := w.Write(ctx, c.Bytes)
-		if err != nil {
-			return nil, 0, "", fmt.Errorf("blob write: %v", err)
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			writes = append(writes, job)
+			sizes = append(sizes, int64(len(c.Bytes)))
 		}
+	}()
+
+	wg.Wait()
+
+	// a write error cancels chunking, so it is the cause of the chunk error.
+	if writeErr != nil {
+		return nil, nil, 0, "", writeErr
+	}
+	if chunkErr != nil {
+		return nil, nil, 0, "", chunkErr
+	}
 
-		hashes = append(hashes, h)
+	refs = make([]fixity.Ref, len(writes))
+	for i, job := range writes {
+		refs[i] = job.ref
 	}
 
 	hash := hex.EncodeToString(hasher.Sum(nil)[:])
-	return hashes, totalSize, hash, nil
+	return refs, sizes, totalSize, hash, nil
 }
 
 func MarshalAndWrite(ctx context.Context, w fixity.BlobWriter, v interface{}) (fixity.Ref, error) {
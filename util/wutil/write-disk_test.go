@@ -0,0 +1,214 @@
+package wutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leeola/fixity"
+	"github.com/leeola/fixity/blobstore/disk"
+	"github.com/leeola/fixity/blobstore/memory"
+	"github.com/leeola/fixity/chunk"
+	"github.com/leeola/fixity/config"
+)
+
+// fixedChunker chunks at a fixed size, reusing the chunk bytes like the
+// content defined chunkers do.
+type fixedChunker struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (c *fixedChunker) Chunk(ctx context.Context) (chunk.Chunk, error) {
+	if err := ctx.Err(); err != nil {
+		return chunk.Chunk{}, err
+	}
+
+	n, err := io.ReadFull(c.r, c.buf)
+	if err == io.EOF {
+		return chunk.Chunk{}, io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return chunk.Chunk{}, err
+	}
+
+	return chunk.Chunk{Bytes: c.buf[:n], Size: int64(n)}, nil
+}
+
+// failWriter fails the nth write.
+type failWriter struct {
+	fixity.BlobWriter
+	n      int32
+	writes int32
+}
+
+func (w *failWriter) Write(ctx context.Context, b []byte) (fixity.Ref, error) {
+	if atomic.AddInt32(&w.writes, 1) == w.n {
+		return "", errors.New("failed write")
+	}
+	return w.BlobWriter.Write(ctx, b)
+}
+
+// latencyWriter delays every write, as a network blobstore would.
+type latencyWriter struct {
+	fixity.BlobWriter
+	latency time.Duration
+}
+
+func (w latencyWriter) Write(ctx context.Context, b []byte) (fixity.Ref, error) {
+	time.Sleep(w.latency)
+	return w.BlobWriter.Write(ctx, b)
+}
+
+func randomContent(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestWriteChunksParallel(t *testing.T) {
+	ctx := context.Background()
+	content := randomContent(1 << 20)
+
+	bs := memory.New()
+	wantRefs, wantSizes, wantSize, wantHash, err := WriteChunksParallel(ctx, bs,
+		&fixedChunker{r: bytes.NewReader(content), buf: make([]byte, 1000)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, sizes, size, hash, err := WriteChunksParallel(ctx, bs,
+		&fixedChunker{r: bytes.NewReader(content), buf: make([]byte, 1000)}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != wantSize || hash != wantHash || len(refs) != len(wantRefs) {
+		t.Fatalf("want size:%d hash:%s refs:%d, got size:%d hash:%s refs:%d",
+			wantSize, wantHash, len(wantRefs), size, hash, len(refs))
+	}
+
+	var got []byte
+	for i, ref := range refs {
+		if ref != wantRefs[i] || sizes[i] != wantSizes[i] {
+			t.Fatalf("chunk %d want:%s/%d, got:%s/%d", i, wantRefs[i], wantSizes[i], ref, sizes[i])
+		}
+		rc, err := bs.Read(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b...)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("chunks do not match content")
+	}
+
+	w := &failWriter{BlobWriter: bs, n: 10}
+	if _, _, _, _, err := WriteChunksParallel(ctx, w,
+		&fixedChunker{r: bytes.NewReader(content), buf: make([]byte, 1000)}, 4); err == nil {
+		t.Error("want write error")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, _, _, err := WriteChunksParallel(cctx, bs,
+		&fixedChunker{r: bytes.NewReader(content), buf: make([]byte, 1000)}, 4); err == nil {
+		t.Error("want cancelled error")
+	}
+}
+
+// writeChunksSerial chunks, hashes and writes each chunk in turn, as a
+// baseline for WriteChunksParallel.
+func writeChunksSerial(ctx context.Context, w fixity.BlobWriter, r chunk.Chunker) error {
+	hasher, err := fixity.Hasher(fixity.DefaultMultihashName)
+	if err != nil {
+		return err
+	}
+
+	for {
+		c, err := r.Chunk(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		hasher.Write(c.Bytes)
+		if _, err := w.Write(ctx, c.Bytes); err != nil {
+			return err
+		}
+	}
+}
+
+func BenchmarkWriteChunks(b *testing.B) {
+	content := randomContent(16 << 20)
+
+	dir, err := ioutil.TempDir("", "fixity-wutil")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	diskConfig, err := json.Marshal(disk.Config{Path: dir})
+	if err != nil {
+		b.Fatal(err)
+	}
+	diskStore, err := disk.New("disk", config.Config{
+		BlobstoreConfigs: map[string]config.TypeConfig{
+			"disk": {Config: diskConfig},
+		},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	stores := []struct {
+		Name string
+		New  func() fixity.BlobWriter
+	}{
+		{"memory", func() fixity.BlobWriter { return memory.New() }},
+		{"disk", func() fixity.BlobWriter { return diskStore }},
+		{"latency", func() fixity.BlobWriter {
+			return latencyWriter{BlobWriter: memory.New(), latency: time.Millisecond}
+		}},
+	}
+
+	// workers of zero is the serial baseline.
+	for _, store := range stores {
+		for _, workers := range []int{0, 1, DefaultWriteWorkers, 16} {
+			b.Run(fmt.Sprintf("%s/workers=%d", store.Name, workers), func(b *testing.B) {
+				b.SetBytes(int64(len(content)))
+				for i := 0; i < b.N; i++ {
+					// unique content per iteration, so disk writes are not
+					// skipped as existing blobs.
+					c := append([]byte(fmt.Sprintf("%s %d %d", store.Name, workers, i)), content...)
+					r := &fixedChunker{r: bytes.NewReader(c), buf: make([]byte, 64<<10)}
+
+					var err error
+					if workers == 0 {
+						err = writeChunksSerial(context.Background(), store.New(), r)
+					} else {
+						_, _, _, _, err = WriteChunksParallel(context.Background(), store.New(), r, workers)
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package fixity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrNotSupported is returned by an optional Blobstore interface which
+// the Blobstore cannot support at runtime, such as on some platforms.
+var ErrNotSupported = errors.New("not supported by blobstore")
+
+// CorruptBlobError is returned at the end of a verified blob read when the
+// read bytes do not hash to the requested ref.
+type CorruptBlobError struct {
+	Ref Ref
+}
+
+func (e *CorruptBlobError) Error() string {
+	return fmt.Sprintf("corrupt blob: bytes do not match ref %q", e.Ref)
+}
+
+// VerifyReader hashes the bytes read from the underlying reader, returning
+// a *CorruptBlobError instead of io.EOF if the hash does not match the ref.
+type VerifyReader struct {
+	rc     io.ReadCloser
+	ref    Ref
+	hasher hash.Hash
+	digest []byte
+}
+
+func NewVerifyReader(ref Ref, rc io.ReadCloser) (*VerifyReader, error) {
+	name, err := ref.HashName()
+	if err != nil {
+		return nil, fmt.Errorf("hashname: %v", err)
+	}
+
+	digest, err := ref.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("digest: %v", err)
+	}
+
+	hasher, err := Hasher(name)
+	if err != nil {
+		return nil, fmt.Errorf("hasher: %v", err)
+	}
+
+	return &VerifyReader{
+		rc:     rc,
+		ref:    ref,
+		hasher: hasher,
+		digest: digest,
+	}, nil
+}
+
+func (r *VerifyReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	// hash.Hash never returns an error.
+	r.hasher.Write(p[:n])
+
+	if err == io.EOF && !bytes.Equal(r.hasher.Sum(nil), r.digest) {
+		return n, &CorruptBlobError{Ref: r.ref}
+	}
+
+	return n, err
+}
+
+func (r *VerifyReader) Close() error {
+	return r.rc.Close()
+}
+
+// VerifyBlobstore wraps a Blobstore, verifying all read blobs with a
+// VerifyReader.
+type VerifyBlobstore struct {
+	Blobstore
+}
+
+// NewVerifyBlobstore returns a VerifyBlobstore wrapping bs, which also
+// implements each optional Blobstore interface implemented by bs, and no
+// others. The optional interfaces are passed through to bs unverified.
+func NewVerifyBlobstore(bs Blobstore) Blobstore {
+	v := &VerifyBlobstore{Blobstore: bs}
+
+	l, isL := bs.(BlobLister)
+	d, isD := bs.(BlobDeleter)
+	s, isS := bs.(BlobStater)
+	w, isW := bs.(BlobWriteLocker)
+
+	switch {
+	case isL && isD && isS && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobDeleter
+			BlobStater
+			BlobWriteLocker
+		}{v, l, d, s, w}
+	case isL && isD && isS:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobDeleter
+			BlobStater
+		}{v, l, d, s}
+	case isL && isD && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobDeleter
+			BlobWriteLocker
+		}{v, l, d, w}
+	case isL && isS && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobStater
+			BlobWriteLocker
+		}{v, l, s, w}
+	case isD && isS && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobDeleter
+			BlobStater
+			BlobWriteLocker
+		}{v, d, s, w}
+	case isL && isD:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobDeleter
+		}{v, l, d}
+	case isL && isS:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobStater
+		}{v, l, s}
+	case isL && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+			BlobWriteLocker
+		}{v, l, w}
+	case isD && isS:
+		return struct {
+			*VerifyBlobstore
+			BlobDeleter
+			BlobStater
+		}{v, d, s}
+	case isD && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobDeleter
+			BlobWriteLocker
+		}{v, d, w}
+	case isS && isW:
+		return struct {
+			*VerifyBlobstore
+			BlobStater
+			BlobWriteLocker
+		}{v, s, w}
+	case isL:
+		return struct {
+			*VerifyBlobstore
+			BlobLister
+		}{v, l}
+	case isD:
+		return struct {
+			*VerifyBlobstore
+			BlobDeleter
+		}{v, d}
+	case isS:
+		return struct {
+			*VerifyBlobstore
+			BlobStater
+		}{v, s}
+	case isW:
+		return struct {
+			*VerifyBlobstore
+			BlobWriteLocker
+		}{v, w}
+	default:
+		return v
+	}
+}
+
+func (bs *VerifyBlobstore) Read(ctx context.Context, ref Ref) (io.ReadCloser, error) {
+	rc, err := bs.Blobstore.Read(ctx, ref)
+	if err != nil {
+		// not wrapping to let error values fall through.
+		return nil, err
+	}
+
+	vr, err := NewVerifyReader(ref, rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("newverifyreader: %v", err)
+	}
+
+	return vr, nil
+}
+
+func (bs *VerifyBlobstore) WriteFrom(ctx context.Context, r io.Reader) (Ref, error) {
+	return WriteFrom(ctx, bs.Blobstore, r)
+}
@@ -0,0 +1,79 @@
+package fixity
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestVerifyReader(t *testing.T) {
+	ref, err := Hash([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Bytes   string
+		Corrupt bool
+	}{
+		{Bytes: "foo"},
+		{Bytes: "bar", Corrupt: true},
+		{Bytes: "fo", Corrupt: true},
+		{Bytes: "", Corrupt: true},
+	}
+	for _, tc := range testCases {
+		vr, err := NewVerifyReader(ref, ioutil.NopCloser(bytes.NewReader([]byte(tc.Bytes))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(vr)
+		if string(b) != tc.Bytes {
+			t.Errorf("%q want:%q, got:%q", tc.Bytes, tc.Bytes, b)
+		}
+
+		_, isCorrupt := err.(*CorruptBlobError)
+		if isCorrupt != tc.Corrupt {
+			t.Errorf("%q want corrupt:%t, got err:%v", tc.Bytes, tc.Corrupt, err)
+		}
+		if !tc.Corrupt && err != nil {
+			t.Errorf("%q want no err, got:%v", tc.Bytes, err)
+		}
+	}
+}
+
+// readWriter implements only the required Blobstore methods.
+type readWriter struct{}
+
+func (readWriter) Read(context.Context, Ref) (io.ReadCloser, error) { return nil, nil }
+func (readWriter) Write(context.Context, []byte) (Ref, error)       { return "", nil }
+
+// readLister implements only BlobLister of the optional interfaces.
+type readLister struct {
+	readWriter
+}
+
+func (readLister) List(context.Context, Ref, func(Ref) error) error { return nil }
+
+func TestVerifyBlobstoreInterfaces(t *testing.T) {
+	bs := NewVerifyBlobstore(readWriter{})
+	if _, ok := bs.(BlobLister); ok {
+		t.Error("want no bloblister without a wrapped bloblister")
+	}
+	if _, ok := bs.(BlobWriterFrom); !ok {
+		t.Error("want blobwriterfrom")
+	}
+
+	bs = NewVerifyBlobstore(NewVerifyBlobstore(readLister{}))
+	if _, ok := bs.(BlobLister); !ok {
+		t.Error("want bloblister of the wrapped bloblister")
+	}
+	_, isD := bs.(BlobDeleter)
+	_, isS := bs.(BlobStater)
+	_, isW := bs.(BlobWriteLocker)
+	if isD || isS || isW {
+		t.Error("want only the optional interfaces of the wrapped blobstore")
+	}
+}